@@ -4,6 +4,7 @@ package moments
 import (
 	"fmt"
 	"log/slog"
+	"reflect"
 )
 
 type (
@@ -25,11 +26,15 @@ type (
 		aggregateType AggregateType
 		// id is the unique identifier for this aggregate instance
 		id string
+		// idGenerator creates the aggregate id and the ids of applied events.
+		// When nil the session's configured IdGenerator is used once the aggregate
+		// is loaded or saved, and UUIDv7Generator before then.
+		idGenerator IdGenerator
 	}
 )
 
 type IAggregate interface {
-	Load(events []any)
+	Load(events []any) error
 	// Version returns the current version of the aggregate
 	Version() Version
 	// UnsavedEvents returns events that have been applied but not yet persisted
@@ -132,7 +137,9 @@ func (a *Aggregate[TState]) ClearUnsavedEvents() {
 // Load applies a slice of events to the aggregate.
 // It accepts both Event and PersistedEvent types, converting them as needed.
 // This method is typically used to reconstruct an aggregate from its event history.
-func (a *Aggregate[TState]) Load(events []any) {
+// Returns ErrUnknownEvent, leaving the aggregate unchanged, when its reducer was built by
+// EventHandlers.Reducer with ErrorOnUnknownEvent and has no handler for one of the events.
+func (a *Aggregate[TState]) Load(events []any) error {
 	ed := []Event{}
 	for _, evt := range events {
 		switch evt := evt.(type) {
@@ -141,32 +148,49 @@ func (a *Aggregate[TState]) Load(events []any) {
 		case Event:
 			ed = append(ed, evt)
 		default:
-			ed = append(ed, NewEvent(evt, nil))
+			ed = append(ed, newEvent(evt, nil, a.ids()))
 		}
 	}
-	a.load(ed)
+	return a.load(ed)
 }
 
 // load is an internal method that applies a slice of Event objects to the aggregate.
 // It extracts the data from each event, applies it using the reducer, and updates the version.
-func (a *Aggregate[T]) load(events []Event) {
+func (a *Aggregate[T]) load(events []Event) error {
 	ed := mapSlice(events, func(e Event) any {
 		return e.Data
 	})
 
-	a.state = a.reducer(a.state, ed...)
+	state, err := a.reduce(ed...)
+	if err != nil {
+		return err
+	}
+	a.state = state
 	a.version += Version(len(ed))
+	return nil
 }
 
 // Apply creates a new event from the provided data and applies it to the aggregate.
 // It updates the state using the reducer, increments the version, and adds the event to unsavedEvents.
-// Returns the new state after applying the event.
-func (a *Aggregate[T]) Apply(data any, args *ApplyArgs) T {
-	evt := NewEvent(data, args)
-	a.state = a.reducer(a.state, data)
+// Returns the new state after applying the event, or ErrUnknownEvent with the aggregate
+// unchanged when the reducer reports the event as unknown.
+func (a *Aggregate[T]) Apply(data any, args *ApplyArgs) (T, error) {
+	state, err := a.reduce(data)
+	if err != nil {
+		return a.state, err
+	}
+	evt := newEvent(data, args, a.ids())
+	a.state = state
 	a.version++
 	a.unsavedEvents = append(a.unsavedEvents, evt)
-	return a.state
+	return a.state, nil
+}
+
+// reduce runs the reducer over the aggregate's state without changing it, returning the
+// ErrUnknownEvent a Reducer built with ErrorOnUnknownEvent panics with as an error.
+func (a *Aggregate[T]) reduce(events ...any) (state T, err error) {
+	defer recoverUnknownEvent(&err)
+	return a.reducer(a.state, events...), nil
 }
 
 // StreamId returns the unique identifier for this aggregate's event stream.
@@ -191,10 +215,13 @@ type (
 
 // WithEvents creates an option to initialize an aggregate by loading a sequence of events.
 // It sets the aggregate's id and applies the provided events to build the state.
+// As options cannot return an error, it panics when Load fails.
 func WithEvents[T any](id string, events []any) NewOption[T] {
 	return func(a *Aggregate[T]) {
 		a.id = id
-		a.Load(events)
+		if err := a.Load(events); err != nil {
+			panic(err)
+		}
 	}
 }
 
@@ -208,9 +235,46 @@ func WithId[T any](id string) NewOption[T] {
 	}
 }
 
+// WithSnapshot creates an option to initialise an aggregate from a snapshot.
+// The aggregate takes the id of the snapshot's stream.
+func WithSnapshot[T any](snapshot *Snapshot, serialiser *SnapshotSerialiser) NewOption[T] {
+	return func(a *Aggregate[T]) {
+		a.id = snapshot.Id.StreamId.Id
+		a.loadSnapshot(snapshot, serialiser)
+	}
+}
+
+// ids returns the generator for the aggregate's ids.
+func (a *Aggregate[T]) ids() IdGenerator {
+	if a.idGenerator == nil {
+		return UUIDv7Generator
+	}
+	return a.idGenerator
+}
+
+// useDefaultIdGenerator sets the generator for the aggregate's ids unless one was
+// given when the aggregate was created.
+func (a *Aggregate[T]) useDefaultIdGenerator(idGenerator IdGenerator) {
+	if a.idGenerator == nil {
+		a.idGenerator = idGenerator
+	}
+}
+
+// WithIdGenerator creates an option to set the generator used for the aggregate id
+// and the ids of events applied to it.
+func WithIdGenerator[T any](idGenerator IdGenerator) NewOption[T] {
+	return func(a *Aggregate[T]) {
+		if idGenerator != nil {
+			a.idGenerator = idGenerator
+		}
+	}
+}
+
 // NewAggregateFactory creates a factory function for producing aggregates of a specific type.
 // It encapsulates the aggregate type, initial state function, and reducer function.
 // The returned factory function can be used to create new aggregate instances with various options.
+// Aggregates created without WithId or WithIdGenerator are given an id from UUIDv7Generator,
+// as the factory has no config; use RegisterAggregate for factories using Config.IdGenerator.
 func NewAggregateFactory[T any](
 	aggregateType AggregateType, initial InitialStateFunc[T], reducer Reducer[T],
 ) newAggregateFunc[T] {
@@ -219,6 +283,48 @@ func NewAggregateFactory[T any](
 	}
 }
 
+// RegisterAggregate wires an aggregate type into the config in a single call.
+// It adds the aggregate config, registers a deserialiser for each of the provided
+// events and returns a factory for creating aggregates of that type that uses the
+// config's IdGenerator.
+// events should contain a zero value of every event type the aggregate produces.
+func RegisterAggregate[T any](
+	config *Config, aggregateType AggregateType, aggregateConfig AggregateConfig,
+	initial InitialStateFunc[T], reducer Reducer[T], events ...any,
+) (newAggregateFunc[T], error) {
+	if _, exists := config.Aggregates[aggregateType]; exists {
+		return nil, fmt.Errorf("aggregate type %v is already registered", aggregateType)
+	}
+	// Check every event before changing the config, so a failed registration leaves it untouched
+	for _, evt := range events {
+		if evt == nil {
+			return nil, fmt.Errorf("aggregate %v: nil event", aggregateType)
+		}
+		if _, err := GetEventType(evt); err != nil {
+			return nil, fmt.Errorf("aggregate %v: %w", aggregateType, err)
+		}
+	}
+	if config.EventDeserialiser == nil {
+		deserialiser := NewEventDeserialiser()
+		config.EventDeserialiser = &deserialiser
+	}
+	for _, evt := range events {
+		eventType, err := addJsonEventDeserialiser(*config.EventDeserialiser, reflect.TypeOf(evt))
+		if err != nil {
+			return nil, fmt.Errorf("aggregate %v: %w", aggregateType, err)
+		}
+		aggregateConfig.EventTypes = append(aggregateConfig.EventTypes, *eventType)
+	}
+	if config.Aggregates == nil {
+		config.Aggregates = map[AggregateType]AggregateConfig{}
+	}
+	config.Aggregates[aggregateType] = aggregateConfig
+	return func(options ...NewOption[T]) *Aggregate[T] {
+		options = append([]NewOption[T]{WithIdGenerator[T](config.IdGenerator)}, options...)
+		return newAggregate(aggregateType, initial(), reducer, options...)
+	}, nil
+}
+
 // newAggregate creates and configures a new Aggregate instance.
 // It initializes the aggregate with the provided type, state, and reducer,
 // then applies any configuration options.
@@ -228,11 +334,13 @@ func newAggregate[T any](aggregateType AggregateType, initial T, reducer Reducer
 		state:         initial,
 		reducer:       reducer,
 		version:       0,
-		id:            newSquentialString(),
 	}
 	for _, opt := range opts {
 		opt(&a)
 	}
+	if a.id == "" {
+		a.id = a.ids().NewId()
+	}
 	return &a
 }
 
@@ -81,3 +81,64 @@ func TestLoadAggregate(t *testing.T) {
 	assert.Equal(t, 7, calc2.State().Value)
 	assert.Empty(t, calc2.UnsavedEvents())
 }
+
+func TestRegisterAggregate(t *testing.T) {
+	config := Config{}
+	newCalc, err := RegisterAggregate(&config, calculatorType, AggregateConfig{StoreStrategy: alwaysSnapshot},
+		initStateFunc, reducer,
+		calculator_added_v1{}, calculator_subtracted_v1{}, calculator_updated_v1{})
+	assert.NoError(t, err)
+	assert.Equal(t, alwaysSnapshot, config.Aggregates[calculatorType].StoreStrategy)
+	assert.Len(t, config.Aggregates[calculatorType].EventTypes, 3)
+	assert.Len(t, config.EventDeserialiser.funcs, 3)
+
+	provider := NewMemoryStoreProvider(&config)
+	provider.NewTenant("default")
+	sessionProvider, err := NewSessionProvider(provider, config)
+	assert.NoError(t, err)
+	session, err := sessionProvider.NewSession("default")
+	assert.NoError(t, err)
+	defer session.Close()
+
+	calc := newCalc()
+	calc.Apply(calculator_added_v1{Value: 4}, nil)
+	assert.NoError(t, session.Save(calc))
+
+	loaded := newCalc(WithId[calculatorState](calc.Id()))
+	assert.NoError(t, session.LoadAggregate(loaded))
+	assert.Equal(t, 4, loaded.State().Value)
+}
+
+func TestRegisterAggregateTwiceFails(t *testing.T) {
+	config := Config{}
+	_, err := RegisterAggregate(&config, calculatorType, AggregateConfig{}, initStateFunc, reducer)
+	assert.NoError(t, err)
+	_, err = RegisterAggregate(&config, calculatorType, AggregateConfig{}, initStateFunc, reducer)
+	assert.Error(t, err)
+}
+
+func TestRegisterAggregateWithUnresolvableEventFails(t *testing.T) {
+	config := Config{}
+	_, err := RegisterAggregate(&config, calculatorType, AggregateConfig{}, initStateFunc, reducer, struct{}{})
+	assert.Error(t, err)
+	assert.NotContains(t, config.Aggregates, calculatorType)
+
+	deserialiser := NewEventDeserialiser()
+	config.EventDeserialiser = &deserialiser
+	_, err = RegisterAggregate(&config, calculatorType, AggregateConfig{}, initStateFunc, reducer,
+		calculator_added_v1{}, struct{}{})
+	assert.Error(t, err)
+	assert.Empty(t, deserialiser.funcs)
+}
+
+func TestWithSnapshot(t *testing.T) {
+	calc := newCalculator("c1")
+	calc.update(5)
+	calc.add(2)
+	snapshot := calc.CreateSnapshot(JsonSnapshotSerialiser)
+
+	restored := newCalculatorAggregate(WithSnapshot[calculatorState](&snapshot, &JsonSnapshotSerialiser))
+	assert.Equal(t, "c1", restored.Id())
+	assert.Equal(t, Version(2), restored.Version())
+	assert.Equal(t, 7, restored.State().Value)
+}
@@ -0,0 +1,385 @@
+package moments
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrInvalidBackup is returned when a backup cannot be read or does not follow the backup before it.
+var ErrInvalidBackup = errors.New("invalid backup")
+
+const backupManifestName = "manifest.json"
+
+// BackupManifest describes a backup. A full backup holds every event of every tenant up to
+// its cut, an incremental backup the events saved between the cut of the backup it follows
+// and its own.
+type BackupManifest struct {
+	FormatVersion int
+	CreatedAt     time.Time
+	// From is the cut of the backup this backup follows, nil for a full backup
+	From map[TenantId]Sequence `json:",omitempty"`
+	// Cut is the GlobalSequence of each tenant's last backed up event
+	Cut map[TenantId]Sequence
+	// Hashes is the Hash of each tenant's last backed up event
+	Hashes map[TenantId]string
+	// Tenants summarises the events, streams and snapshots backed up for each tenant
+	Tenants []ExportSummary
+}
+
+// Incremental reports whether the backup follows another backup.
+func (m *BackupManifest) Incremental() bool {
+	return m.From != nil
+}
+
+// Backup writes a tar archive holding the events of every tenant up to a cut taken as the
+// backup starts. Writes can continue while the backup runs: events are never changed once
+// saved, so those saved after the cut are simply left for the next backup. When previous is
+// given only the events saved since its cut are written, making an incremental backup.
+// Each tenant is written in the ExportTenant format after a manifest.json describing the backup,
+// so like an export a backup holds event data and snapshot state without PayloadCodecs applied.
+// Tenants are spooled to temporary files until the manifest is written, so the backup needs
+// temporary disk space rather than memory for the tenants' events.
+func Backup(w io.Writer, provider StoreProvider, config *Config, previous *BackupManifest) (*BackupManifest, error) {
+	feed, ok := provider.(ReplicationFeed)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T does not implement ReplicationFeed", ErrInvalidBackup, provider)
+	}
+	tenants, err := feed.Tenants()
+	if err != nil {
+		return nil, err
+	}
+	manifest := &BackupManifest{
+		FormatVersion: ExportFormatVersion,
+		CreatedAt:     config.now(),
+		Cut:           map[TenantId]Sequence{},
+		Hashes:        map[TenantId]string{},
+	}
+	if previous != nil {
+		manifest.From = maps.Clone(previous.Cut)
+	}
+	// Take the cut of every tenant before exporting any of them so the backup is as close
+	// to a single point in time as the tenants' separate logs allow
+	for _, tenant := range tenants {
+		if manifest.Cut[tenant], err = feed.HeadSequence(tenant); err != nil {
+			return nil, err
+		}
+	}
+
+	// Tenants are spooled to temporary files, as the manifest describing them comes first
+	files := map[TenantId]*os.File{}
+	defer func() {
+		for _, file := range files {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+	for _, tenant := range tenants {
+		from := manifest.From[tenant]
+		cut := manifest.Cut[tenant]
+		if previous != nil {
+			manifest.Hashes[tenant] = previous.Hashes[tenant]
+			if _, exists := previous.Cut[tenant]; exists && cut == from {
+				continue
+			}
+		}
+		if cut < from {
+			return nil, fmt.Errorf("%w: tenant %v is at sequence %v, before the previous cut %v",
+				ErrInvalidBackup, tenant, cut, from)
+		}
+		if _, err := tenantFileName(tenant); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+		}
+		file, err := os.CreateTemp("", "moments-backup-*.jsonl")
+		if err != nil {
+			return nil, err
+		}
+		files[tenant] = file
+		summary, err := exportTenant(file, provider, config, tenant, from, cut)
+		if err != nil {
+			return nil, err
+		}
+		if summary.Events > 0 {
+			manifest.Hashes[tenant] = summary.LastHash
+		}
+		manifest.Tenants = append(manifest.Tenants, summary)
+	}
+
+	archive := tar.NewWriter(w)
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeBackupFile(archive, backupManifestName, manifest.CreatedAt, bytes.NewReader(manifestData)); err != nil {
+		return nil, err
+	}
+	for _, summary := range manifest.Tenants {
+		name, _ := tenantFileName(summary.Tenant)
+		if err := writeBackupFile(archive, path.Join("tenants", name), manifest.CreatedAt, files[summary.Tenant]); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, archive.Close()
+}
+
+// writeBackupFile writes the whole of r to the archive, seeking to find its size.
+func writeBackupFile(archive *tar.Writer, name string, modTime time.Time, r io.ReadSeeker) error {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	err = archive.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: size, ModTime: modTime})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(archive, r)
+	return err
+}
+
+// RestoreOptions chooses the point in time a restore stops at. When neither is set every
+// backed up event is restored.
+type RestoreOptions struct {
+	// ToSequences restores the given tenants up to and including their GlobalSequence. Each
+	// tenant has a log of its own, so their sequences are unrelated. Tenants without a
+	// sequence are restored in full.
+	ToSequences map[TenantId]Sequence
+	// ToTimestamp restores each tenant up to the first event stamped after the given time
+	ToTimestamp time.Time
+}
+
+func (o RestoreOptions) includes(tenant TenantId, evt PersistedEvent) bool {
+	if to, ok := o.ToSequences[tenant]; ok && evt.GlobalSequence > to {
+		return false
+	}
+	return o.ToTimestamp.IsZero() || !evt.Timestamp.After(o.ToTimestamp)
+}
+
+type restoredTenant struct {
+	store     Store
+	batch     *importBatch
+	summary   ExportSummary
+	streams   map[StreamId]Version
+	snapshots map[SnapshotId]Snapshot
+	stopped   bool
+}
+
+// Restore recreates the tenants of a full backup and the incremental backups that follow it,
+// given in the order they were taken, in a provider that does not yet hold them. Each tenant
+// is restored up to the point chosen by the options, keeping its events' ids, sequences and
+// hashes, so the stores of the provider must implement EventImporter. The latest snapshot of
+// each stream taken at or before its restored version is restored. Each tenant file is checked
+// against its backup's manifest, and tenants restored in full against the cut and hash of the
+// last backup. Restored tenants are summarised in tenant order. When the restore fails the
+// tenants it created are deleted.
+func Restore(provider StoreProvider, config *Config, options RestoreOptions, backups ...io.Reader) (summaries []ExportSummary, err error) {
+	tenants := map[TenantId]*restoredTenant{}
+	defer func() {
+		for _, id := range slices.Sorted(maps.Keys(tenants)) {
+			tenants[id].store.Close()
+			if err != nil {
+				err = errors.Join(err, provider.DeleteTenant(id))
+			}
+		}
+		if err != nil {
+			summaries = nil
+		}
+	}()
+
+	var previous *BackupManifest
+	for i, backup := range backups {
+		archive := tar.NewReader(backup)
+		manifest, err := readBackupManifest(archive)
+		if err != nil {
+			return nil, err
+		}
+		if previous == nil && manifest.Incremental() {
+			return nil, fmt.Errorf("%w: restore must start from a full backup", ErrInvalidBackup)
+		}
+		if previous != nil && !maps.Equal(manifest.From, previous.Cut) {
+			return nil, fmt.Errorf("%w: backup %v does not follow the cut of backup %v", ErrInvalidBackup, i+1, i)
+		}
+		previous = manifest
+
+		for {
+			header, err := archive.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+			}
+			if header.Typeflag != tar.TypeReg || path.Ext(header.Name) != ".jsonl" {
+				continue
+			}
+			id := TenantId(strings.TrimSuffix(strings.TrimPrefix(header.Name, "tenants/"), ".jsonl"))
+			if _, err := tenantFileName(id); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+			}
+			tenant, exists := tenants[id]
+			if !exists {
+				store, importer, err := newImportTarget(provider, id)
+				if err != nil {
+					return nil, err
+				}
+				tenant = &restoredTenant{
+					store:     store,
+					batch:     &importBatch{importer: importer},
+					summary:   ExportSummary{Tenant: id},
+					streams:   map[StreamId]Version{},
+					snapshots: map[SnapshotId]Snapshot{},
+				}
+				tenants[id] = tenant
+			}
+			if err := tenant.restore(archive, config, options, manifest); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if previous == nil {
+		return nil, nil
+	}
+	for id := range previous.Cut {
+		if _, exists := tenants[id]; !exists {
+			return nil, fmt.Errorf("%w: tenant %v is missing from the backups", ErrInvalidBackup, id)
+		}
+	}
+
+	summaries = make([]ExportSummary, 0, len(tenants))
+	for _, id := range slices.Sorted(maps.Keys(tenants)) {
+		tenant := tenants[id]
+		if err := tenant.finish(); err != nil {
+			return nil, err
+		}
+		// Tenants the options stopped early were checked against each backup up to that point
+		lastSequence, lastHash := tenant.summary.LastSequence, tenant.summary.LastHash
+		if cut, exists := previous.Cut[id]; exists && !tenant.stopped {
+			lastSequence, lastHash = cut, previous.Hashes[id]
+		}
+		if err := verifyStored(provider, tenant.store, id, lastSequence, lastHash, ErrInvalidBackup); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, tenant.summary)
+	}
+	return summaries, nil
+}
+
+func readBackupManifest(archive *tar.Reader) (*BackupManifest, error) {
+	header, err := archive.Next()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+	}
+	if header.Name != backupManifestName {
+		return nil, fmt.Errorf("%w: missing %v", ErrInvalidBackup, backupManifestName)
+	}
+	var manifest BackupManifest
+	if err := json.NewDecoder(archive).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+	}
+	if manifest.FormatVersion > ExportFormatVersion {
+		return nil, fmt.Errorf("%w: unsupported format version %v", ErrInvalidBackup, manifest.FormatVersion)
+	}
+	return &manifest, nil
+}
+
+// restore imports the tenant's events from one backup, stopping at the first event
+// the options exclude, and checks them against the backup's manifest.
+func (t *restoredTenant) restore(r io.Reader, config *Config, options RestoreOptions, manifest *BackupManifest) error {
+	reader, err := newExportReader(r)
+	if err != nil {
+		return err
+	}
+	if !t.stopped && reader.header.After != t.summary.LastSequence {
+		return fmt.Errorf("%w: tenant %v is restored to sequence %v, backup starts after %v",
+			ErrInvalidBackup, t.summary.Tenant, t.summary.LastSequence, reader.header.After)
+	}
+	for {
+		record, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch record.Type {
+		case exportEventRecord:
+			if t.stopped || !options.includes(t.summary.Tenant, record.Event.PersistedEvent) {
+				t.stopped = true
+				continue
+			}
+			evt, err := record.Event.decode(config)
+			if err != nil {
+				return err
+			}
+			if evt.PreviousGlobalHash != t.summary.LastHash {
+				return fmt.Errorf("%w: event %v of tenant %v does not follow the restored events",
+					ErrInvalidBackup, evt.GlobalSequence, t.summary.Tenant)
+			}
+			if err := t.batch.add(evt); err != nil {
+				return err
+			}
+			if _, exists := t.streams[evt.StreamId]; !exists {
+				t.summary.Streams++
+			}
+			t.streams[evt.StreamId] = evt.Version
+			t.summary.Events++
+			t.summary.LastSequence = evt.GlobalSequence
+			t.summary.LastHash = evt.Hash
+		case exportSnapshotRecord:
+			// Snapshots taken after their stream's restored version, or older than one already
+			// kept, are dropped. Those taken at or before it still hold the restored state, even
+			// when they come after the restore point in the backup.
+			snapshot := record.Snapshot
+			if snapshot.Version > t.streams[snapshot.Id.StreamId] {
+				continue
+			}
+			if kept, exists := t.snapshots[snapshot.Id]; exists && kept.Version > snapshot.Version {
+				continue
+			}
+			t.snapshots[snapshot.Id] = *snapshot
+		}
+	}
+	i := slices.IndexFunc(manifest.Tenants, func(s ExportSummary) bool { return s.Tenant == t.summary.Tenant })
+	if i < 0 || manifest.Tenants[i] != *reader.footer {
+		return fmt.Errorf("%w: tenant %v does not match the backup manifest", ErrInvalidBackup, t.summary.Tenant)
+	}
+	if t.stopped {
+		return nil
+	}
+	if reader.footer.Events > 0 && reader.footer.LastHash != t.summary.LastHash {
+		return fmt.Errorf("%w: tenant %v does not match the hash of the backup", ErrInvalidBackup, t.summary.Tenant)
+	}
+	if t.summary.LastSequence != manifest.Cut[t.summary.Tenant] || t.summary.LastHash != manifest.Hashes[t.summary.Tenant] {
+		return fmt.Errorf("%w: tenant %v does not match the cut of the backup", ErrInvalidBackup, t.summary.Tenant)
+	}
+	return nil
+}
+
+// finish imports the remaining events and the latest snapshot of each stream taken at or
+// before its restored version.
+func (t *restoredTenant) finish() error {
+	if err := t.batch.flush(); err != nil {
+		return err
+	}
+	for _, id := range slices.SortedFunc(maps.Keys(t.snapshots), func(a, b SnapshotId) int {
+		return strings.Compare(a.String(), b.String())
+	}) {
+		snapshot := t.snapshots[id]
+		if err := t.store.SaveSnapshot(&snapshot); err != nil {
+			return err
+		}
+		t.summary.Snapshots++
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package moments
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type backupFixture struct {
+	provider *MemoryStoreProvider
+	config   *Config
+	mu       sync.Mutex
+	now      time.Time
+}
+
+func newBackupFixture(t *testing.T, tenants ...TenantId) *backupFixture {
+	f := &backupFixture{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	f.provider, f.config = createExportProvider(t, tenants...)
+	f.config.Clock = ClockFunc(func() time.Time {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return f.now
+	})
+	return f
+}
+
+func (f *backupFixture) tick() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(time.Minute)
+}
+
+func (f *backupFixture) add(t *testing.T, tenant TenantId, id string, values ...int) {
+	calc := newCalculator(id)
+	session := exportSession(t, f.provider, f.config, tenant)
+	require.NoError(t, session.LoadAggregate(calc))
+	for _, value := range values {
+		calc.add(value)
+	}
+	require.NoError(t, session.Save(calc))
+}
+
+func (f *backupFixture) backup(t *testing.T, previous *BackupManifest) (*bytes.Buffer, *BackupManifest) {
+	var buf bytes.Buffer
+	manifest, err := Backup(&buf, f.provider, f.config, previous)
+	require.NoError(t, err)
+	return &buf, manifest
+}
+
+func TestFullAndIncrementalBackupRestore(t *testing.T) {
+	f := newBackupFixture(t, "acme", "globex")
+	saveCalculators(t, exportSession(t, f.provider, f.config, "acme"))
+	f.add(t, "globex", "g1", 1)
+	full, fullManifest := f.backup(t, nil)
+	assert.False(t, fullManifest.Incremental())
+	assert.Equal(t, map[TenantId]Sequence{"acme": 6, "globex": 1}, fullManifest.Cut)
+
+	f.add(t, "acme", "c2", 3)
+	require.NoError(t, f.provider.NewTenant("initech"))
+	f.add(t, "initech", "i1", 4)
+	incremental, incrementalManifest := f.backup(t, fullManifest)
+	assert.True(t, incrementalManifest.Incremental())
+	assert.Equal(t, map[TenantId]Sequence{"acme": 7, "globex": 1, "initech": 1}, incrementalManifest.Cut)
+	assert.Equal(t, []TenantId{"acme", "initech"},
+		mapSlice(incrementalManifest.Tenants, func(s ExportSummary) TenantId { return s.Tenant }))
+	assert.Equal(t, fullManifest.Hashes["globex"], incrementalManifest.Hashes["globex"])
+
+	target, _ := createExportProvider(t)
+	summaries, err := Restore(target, f.config, RestoreOptions{}, full, incremental)
+	require.NoError(t, err)
+	assert.Equal(t, []TenantId{"acme", "globex", "initech"},
+		mapSlice(summaries, func(s ExportSummary) TenantId { return s.Tenant }))
+	assert.Equal(t, ExportSummary{
+		Tenant: "acme", Streams: 2, Events: 7, Snapshots: 2, LastSequence: 7, LastHash: incrementalManifest.Hashes["acme"],
+	}, summaries[0])
+
+	for _, tenant := range []TenantId{"acme", "globex", "initech"} {
+		want, err := f.provider.ReadFeed(tenant, 0, 0)
+		require.NoError(t, err)
+		got, err := target.ReadFeed(tenant, 0, 0)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	loaded := newCalculator("c2")
+	require.NoError(t, exportSession(t, target, f.config, "acme").LoadAggregate(loaded))
+	assert.Equal(t, 6, loaded.State().Value)
+}
+
+func TestRestoreToSequence(t *testing.T) {
+	f := newBackupFixture(t, "acme")
+	saveCalculators(t, exportSession(t, f.provider, f.config, "acme"))
+	full, _ := f.backup(t, nil)
+
+	target, _ := createExportProvider(t)
+	summaries, err := Restore(target, f.config, RestoreOptions{ToSequences: map[TenantId]Sequence{"acme": 4}}, full)
+	require.NoError(t, err)
+	// c1 was snapshotted at version 4, after the restore point, so only c2's snapshot is restored
+	assert.Equal(t, 4, summaries[0].Events)
+	assert.Equal(t, 1, summaries[0].Snapshots)
+	head, err := target.HeadSequence("acme")
+	require.NoError(t, err)
+	assert.Equal(t, Sequence(4), head)
+
+	loaded := newCalculator("c2")
+	require.NoError(t, exportSession(t, target, f.config, "acme").LoadAggregate(loaded))
+	assert.Equal(t, 3, loaded.State().Value)
+}
+
+func TestRestoreToTimestampAcrossBackups(t *testing.T) {
+	f := newBackupFixture(t, "acme")
+	f.add(t, "acme", "c1", 1)
+	full, fullManifest := f.backup(t, nil)
+	f.tick()
+	f.add(t, "acme", "c1", 2)
+	restorePoint := f.now
+	f.tick()
+	f.add(t, "acme", "c1", 3)
+	incremental, incrementalManifest := f.backup(t, fullManifest)
+	f.add(t, "acme", "c1", 4)
+	latest, _ := f.backup(t, incrementalManifest)
+
+	target, _ := createExportProvider(t)
+	summaries, err := Restore(target, f.config, RestoreOptions{ToTimestamp: restorePoint}, full, incremental, latest)
+	require.NoError(t, err)
+	assert.Equal(t, Sequence(2), summaries[0].LastSequence)
+	events, err := target.ReadFeed("acme", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []any{calculator_added_v1{Value: 1}, calculator_added_v1{Value: 2}},
+		mapSlice(events, func(e PersistedEvent) any { return e.Data }))
+}
+
+func TestRestoreRejectsBackupsOutOfOrder(t *testing.T) {
+	f := newBackupFixture(t, "acme")
+	f.add(t, "acme", "c1", 1)
+	full, fullManifest := f.backup(t, nil)
+	f.add(t, "acme", "c1", 2)
+	first, firstManifest := f.backup(t, fullManifest)
+	f.add(t, "acme", "c1", 3)
+	second, _ := f.backup(t, firstManifest)
+
+	target, _ := createExportProvider(t)
+	_, err := Restore(target, f.config, RestoreOptions{}, bytes.NewReader(first.Bytes()))
+	assert.ErrorIs(t, err, ErrInvalidBackup)
+	assert.ErrorContains(t, err, "full backup")
+
+	target, _ = createExportProvider(t)
+	_, err = Restore(target, f.config, RestoreOptions{}, full, second)
+	assert.ErrorIs(t, err, ErrInvalidBackup)
+}
+
+func TestBackupWhileWriting(t *testing.T) {
+	f := newBackupFixture(t, "acme")
+	stop := make(chan struct{})
+	done := make(chan error)
+	session := exportSession(t, f.provider, f.config, "acme")
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				done <- nil
+				return
+			default:
+			}
+			calc := newCalculator(fmt.Sprint("c", i%5))
+			if err := session.LoadAggregate(calc); err != nil {
+				done <- err
+				return
+			}
+			calc.add(i)
+			if err := session.Save(calc); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+
+	var backups []io.Reader
+	var manifest *BackupManifest
+	for range 5 {
+		var backup *bytes.Buffer
+		backup, manifest = f.backup(t, manifest)
+		backups = append(backups, backup)
+	}
+	close(stop)
+	require.NoError(t, <-done)
+
+	target, _ := createExportProvider(t)
+	summaries, err := Restore(target, f.config, RestoreOptions{}, backups...)
+	require.NoError(t, err)
+	assert.Equal(t, manifest.Cut["acme"], summaries[0].LastSequence)
+	want, err := f.provider.ReadFeed("acme", 0, uint(manifest.Cut["acme"]))
+	require.NoError(t, err)
+	got, err := target.ReadFeed("acme", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
+
+// rewriteManifest returns a copy of the backup with its manifest changed by edit.
+func rewriteManifest(t *testing.T, backup *bytes.Buffer, edit func(*BackupManifest)) *bytes.Buffer {
+	archive := tar.NewReader(bytes.NewReader(backup.Bytes()))
+	manifest, err := readBackupManifest(archive)
+	require.NoError(t, err)
+	edit(manifest)
+	data, err := json.Marshal(manifest)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	rewritten := tar.NewWriter(&buf)
+	require.NoError(t, writeBackupFile(rewritten, backupManifestName, manifest.CreatedAt, bytes.NewReader(data)))
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(archive)
+		require.NoError(t, err)
+		require.NoError(t, writeBackupFile(rewritten, header.Name, header.ModTime, bytes.NewReader(data)))
+	}
+	require.NoError(t, rewritten.Close())
+	return &buf
+}
+
+func TestRestoreChecksBackupsAgainstTheirManifests(t *testing.T) {
+	f := newBackupFixture(t, "acme", "globex")
+	saveCalculators(t, exportSession(t, f.provider, f.config, "acme"))
+	f.add(t, "globex", "g1", 1)
+	full, fullManifest := f.backup(t, nil)
+	f.add(t, "acme", "c2", 3)
+	incremental, _ := f.backup(t, fullManifest)
+
+	for name, edit := range map[string]func(*BackupManifest){
+		"hash":    func(m *BackupManifest) { m.Hashes["acme"] = fullManifest.Hashes["globex"] },
+		"cut":     func(m *BackupManifest) { m.Cut["acme"] = 6 },
+		"summary": func(m *BackupManifest) { m.Tenants[0].Events = 2 },
+		"tenant":  func(m *BackupManifest) { m.Cut["initech"] = 0 },
+	} {
+		t.Run(name, func(t *testing.T) {
+			target, _ := createExportProvider(t)
+			tampered := rewriteManifest(t, incremental, edit)
+			_, err := Restore(target, f.config, RestoreOptions{}, bytes.NewReader(full.Bytes()), tampered)
+			assert.ErrorIs(t, err, ErrInvalidBackup)
+			tenants, err := target.Tenants()
+			require.NoError(t, err)
+			assert.Empty(t, tenants)
+		})
+	}
+}
+
+func TestRestoreRemovesTenantsWhenItFails(t *testing.T) {
+	f := newBackupFixture(t, "acme", "globex")
+	saveCalculators(t, exportSession(t, f.provider, f.config, "acme"))
+	full, _ := f.backup(t, nil)
+
+	target, _ := createExportProvider(t, "globex")
+	summaries, err := Restore(target, f.config, RestoreOptions{}, bytes.NewReader(full.Bytes()))
+	assert.ErrorIs(t, err, ErrInvalidExport)
+	assert.Nil(t, summaries)
+	tenants, err := target.Tenants()
+	require.NoError(t, err)
+	assert.Equal(t, []TenantId{"globex"}, tenants)
+
+	// The failed restore left nothing behind, so it can be retried once the conflict is gone
+	require.NoError(t, target.DeleteTenant("globex"))
+	_, err = Restore(target, f.config, RestoreOptions{}, full)
+	assert.NoError(t, err)
+}
+
+func TestRestoreKeepsSnapshotsTakenBeforeTheRestorePoint(t *testing.T) {
+	f := newBackupFixture(t, "acme")
+	f.add(t, "acme", "c1", 1, 2)
+	full, fullManifest := f.backup(t, nil)
+	restorePoint := f.now
+	f.tick()
+	f.add(t, "acme", "c1", 3)
+	incremental, _ := f.backup(t, fullManifest)
+
+	target, _ := createExportProvider(t)
+	summaries, err := Restore(target, f.config, RestoreOptions{ToTimestamp: restorePoint}, full, incremental)
+	require.NoError(t, err)
+	assert.Equal(t, 2, summaries[0].Events)
+	assert.Equal(t, 1, summaries[0].Snapshots)
+	store, err := target.NewStore("acme")
+	require.NoError(t, err)
+	snapshots, err := store.(SnapshotLister).Snapshots()
+	require.NoError(t, err)
+	assert.Equal(t, []Version{2}, mapSlice(snapshots, func(s Snapshot) Version { return s.Version }))
+}
+
+func TestRestoreToSequencePerTenant(t *testing.T) {
+	f := newBackupFixture(t, "acme", "globex")
+	saveCalculators(t, exportSession(t, f.provider, f.config, "acme"))
+	f.add(t, "globex", "g1", 1, 2, 3)
+	full, _ := f.backup(t, nil)
+
+	target, _ := createExportProvider(t)
+	summaries, err := Restore(target, f.config, RestoreOptions{ToSequences: map[TenantId]Sequence{"acme": 2}}, full)
+	require.NoError(t, err)
+	assert.Equal(t, []Sequence{2, 3}, mapSlice(summaries, func(s ExportSummary) Sequence { return s.LastSequence }))
+}
+
+func TestBackupRejectsTenantIdsWithSlashes(t *testing.T) {
+	f := newBackupFixture(t, "acme/eu")
+	f.add(t, "acme/eu", "c1", 1)
+	_, err := Backup(&bytes.Buffer{}, f.provider, f.config, nil)
+	assert.ErrorIs(t, err, ErrInvalidBackup)
+}
@@ -1,18 +1,14 @@
 package moments
 
-import (
-	"fmt"
-)
-
 type calculator_added_v1 struct {
-	value int
+	Value int
 }
 
 type calculator_updated_v1 struct {
-	value int
+	Value int
 }
 type calculator_subtracted_v1 struct {
-	value int
+	Value int
 }
 
 type calculatorState struct {
@@ -30,21 +26,22 @@ var initStateFunc = func() calculatorState {
 }
 var newCalculatorAggregate = NewAggregateFactory(calculatorType, initStateFunc, reducer)
 
-func reducer(state calculatorState, events ...any) calculatorState {
-	for _, event := range events {
-		switch e := event.(type) {
-		case calculator_added_v1:
-			state.Value += e.value
-		case calculator_subtracted_v1:
-			state.Value -= e.value
-		case calculator_updated_v1:
-			state.Value = e.value
-		default:
-			panic(fmt.Sprintln("unknown event type", e, event))
-		}
-	}
-	return state
-}
+var calculatorHandlers = NewEventHandlers(
+	On(func(state calculatorState, e calculator_added_v1) calculatorState {
+		state.Value += e.Value
+		return state
+	}),
+	On(func(state calculatorState, e calculator_subtracted_v1) calculatorState {
+		state.Value -= e.Value
+		return state
+	}),
+	On(func(state calculatorState, e calculator_updated_v1) calculatorState {
+		state.Value = e.Value
+		return state
+	}),
+)
+
+var reducer = calculatorHandlers.Reducer()
 
 func (c *calculator) subtract(val int) {
 	evt := calculator_subtracted_v1{val}
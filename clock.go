@@ -0,0 +1,19 @@
+package moments
+
+import "time"
+
+// Clock provides the current time. It is read everywhere the library needs a
+// timestamp so tests and replays can be made deterministic.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to a Clock.
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// SystemClock is the default Clock and returns the system time.
+var SystemClock Clock = ClockFunc(time.Now)
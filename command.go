@@ -0,0 +1,143 @@
+package moments
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	// ErrInvariantViolation is returned when applying the decided events would
+	// leave the aggregate in an invalid state.
+	ErrInvariantViolation = errors.New("invariant violation")
+	// ErrNoCommandHandler is returned when a command is dispatched with no registered handler.
+	ErrNoCommandHandler = errors.New("no command handler")
+)
+
+const defaultCommandRetries = 3
+
+type (
+	// Decider runs the decision logic for a command against the current aggregate.
+	// It returns the events to apply, or a domain error to reject the command.
+	Decider[C any, T any] func(aggregate *Aggregate[T], command C) ([]any, error)
+
+	// Invariant validates an aggregate state after the decided events are applied.
+	Invariant[T any] func(state T) error
+
+	// CommandHandlerOption configures a CommandHandler during creation.
+	CommandHandlerOption[C any, T any] func(handler *CommandHandler[C, T])
+)
+
+// CommandHandler loads an aggregate, decides which events a command produces,
+// applies and saves them. Saves that fail with ErrConcurrencyConflict are retried
+// against freshly loaded state.
+type CommandHandler[C any, T any] struct {
+	newAggregate newAggregateFunc[T]
+	aggregateId  func(command C) string
+	decide       Decider[C, T]
+	invariants   []Invariant[T]
+	maxRetries   int
+}
+
+// WithMaxRetries sets how many times a command is retried after a concurrency conflict.
+func WithMaxRetries[C any, T any](retries int) CommandHandlerOption[C, T] {
+	return func(handler *CommandHandler[C, T]) {
+		handler.maxRetries = retries
+	}
+}
+
+// WithInvariant adds an invariant that must hold after the decided events are applied.
+func WithInvariant[C any, T any](invariant Invariant[T]) CommandHandlerOption[C, T] {
+	return func(handler *CommandHandler[C, T]) {
+		handler.invariants = append(handler.invariants, invariant)
+	}
+}
+
+// NewCommandHandler creates a handler for commands of type C targeting aggregates with state T.
+// aggregateId returns the id of the aggregate a command targets. An empty id creates a new aggregate.
+func NewCommandHandler[C any, T any](
+	newAggregate newAggregateFunc[T], aggregateId func(command C) string, decide Decider[C, T],
+	options ...CommandHandlerOption[C, T],
+) *CommandHandler[C, T] {
+	h := CommandHandler[C, T]{
+		newAggregate: newAggregate,
+		aggregateId:  aggregateId,
+		decide:       decide,
+		maxRetries:   defaultCommandRetries,
+	}
+	for _, opt := range options {
+		opt(&h)
+	}
+	return &h
+}
+
+// Handle executes the command and returns the aggregate with the resulting events saved.
+func (h *CommandHandler[C, T]) Handle(session *Session, command C) (*Aggregate[T], error) {
+	id := h.aggregateId(command)
+	for attempt := 0; ; attempt++ {
+		aggregate, err := h.handle(session, id, command)
+		if errors.Is(err, ErrConcurrencyConflict) && attempt < h.maxRetries {
+			continue
+		}
+		return aggregate, err
+	}
+}
+
+func (h *CommandHandler[C, T]) handle(session *Session, id string, command C) (*Aggregate[T], error) {
+	aggregate := h.newAggregate(WithId[T](id))
+	if err := session.LoadAggregate(aggregate); err != nil {
+		return nil, err
+	}
+	events, err := h.decide(aggregate, command)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return aggregate, nil
+	}
+	for _, evt := range events {
+		if _, err := aggregate.Apply(evt, nil); err != nil {
+			return nil, err
+		}
+	}
+	for _, invariant := range h.invariants {
+		if err := invariant(aggregate.State()); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvariantViolation, err)
+		}
+	}
+	if err := session.Save(aggregate); err != nil {
+		return nil, err
+	}
+	return aggregate, nil
+}
+
+// CommandBus routes commands to their handlers by the command's Go type.
+type CommandBus struct {
+	handlers map[reflect.Type]func(session *Session, command any) error
+}
+
+func NewCommandBus() *CommandBus {
+	return &CommandBus{handlers: map[reflect.Type]func(session *Session, command any) error{}}
+}
+
+// RegisterCommandHandler routes commands of type C on the bus to the handler.
+func RegisterCommandHandler[C any, T any](bus *CommandBus, handler *CommandHandler[C, T]) error {
+	ty := reflect.TypeFor[C]()
+	if _, exists := bus.handlers[ty]; exists {
+		return fmt.Errorf("command handler for %v already registered", ty)
+	}
+	bus.handlers[ty] = func(session *Session, command any) error {
+		_, err := handler.Handle(session, command.(C))
+		return err
+	}
+	return nil
+}
+
+// Dispatch sends the command to the handler registered for its type.
+func (b *CommandBus) Dispatch(session *Session, command any) error {
+	handle, ok := b.handlers[reflect.TypeOf(command)]
+	if !ok {
+		return fmt.Errorf("%w for %T", ErrNoCommandHandler, command)
+	}
+	return handle(session, command)
+}
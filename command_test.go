@@ -0,0 +1,164 @@
+package moments
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type addToCalculator struct {
+	Id    string
+	Value int
+}
+
+type resetCalculator struct {
+	Id string
+}
+
+var errNegativeAdd = errors.New("cannot add a negative value")
+
+func addCommandId(cmd addToCalculator) string {
+	return cmd.Id
+}
+
+func resetCommandId(cmd resetCalculator) string {
+	return cmd.Id
+}
+
+func decideAdd(agg *Aggregate[calculatorState], cmd addToCalculator) ([]any, error) {
+	if cmd.Value < 0 {
+		return nil, errNegativeAdd
+	}
+	return []any{calculator_added_v1{Value: cmd.Value}}, nil
+}
+
+func TestCommandHandlerAppliesAndSavesEvents(t *testing.T) {
+	session := createEventSourcedSession(t)
+	defer session.Close()
+	handler := NewCommandHandler(newCalculatorAggregate, addCommandId, decideAdd)
+
+	agg, err := handler.Handle(session, addToCalculator{Id: "c1", Value: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, agg.State().Value)
+	assert.False(t, agg.HasUnsavedChanges())
+
+	agg, err = handler.Handle(session, addToCalculator{Id: "c1", Value: 4})
+	assert.NoError(t, err)
+	assert.Equal(t, 7, agg.State().Value)
+	assert.Equal(t, Version(2), agg.Version())
+}
+
+func TestCommandHandlerReturnsDomainError(t *testing.T) {
+	session := createEventSourcedSession(t)
+	defer session.Close()
+	handler := NewCommandHandler(newCalculatorAggregate, addCommandId, decideAdd)
+
+	_, err := handler.Handle(session, addToCalculator{Id: "c1", Value: -1})
+	assert.ErrorIs(t, err, errNegativeAdd)
+
+	events, err := session.LoadEvents(LoadEventArgs{})
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestCommandHandlerReturnsUnknownEventError(t *testing.T) {
+	session := createEventSourcedSession(t)
+	defer session.Close()
+	handlers := NewEventHandlers(On(func(state calculatorState, e calculator_updated_v1) calculatorState {
+		state.Value = e.Value
+		return state
+	})).OnUnknownEvent(ErrorOnUnknownEvent)
+	newAggregate := NewAggregateFactory(calculatorType, initStateFunc, handlers.Reducer())
+	handler := NewCommandHandler(newAggregate, addCommandId, decideAdd)
+
+	_, err := handler.Handle(session, addToCalculator{Id: "c1", Value: 3})
+	assert.ErrorIs(t, err, ErrUnknownEvent)
+
+	events, err := session.LoadEvents(LoadEventArgs{})
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestCommandHandlerEnforcesInvariants(t *testing.T) {
+	session := createEventSourcedSession(t)
+	defer session.Close()
+	handler := NewCommandHandler(newCalculatorAggregate, addCommandId, decideAdd,
+		WithInvariant[addToCalculator](func(state calculatorState) error {
+			if state.Value > 10 {
+				return errors.New("value exceeds 10")
+			}
+			return nil
+		}))
+
+	_, err := handler.Handle(session, addToCalculator{Id: "c1", Value: 11})
+	assert.ErrorIs(t, err, ErrInvariantViolation)
+	assert.ErrorContains(t, err, "value exceeds 10")
+}
+
+func TestCommandHandlerRetriesConcurrencyConflicts(t *testing.T) {
+	session := createEventSourcedSession(t)
+	defer session.Close()
+	attempts := 0
+	handler := NewCommandHandler(newCalculatorAggregate, addCommandId,
+		func(agg *Aggregate[calculatorState], cmd addToCalculator) ([]any, error) {
+			attempts++
+			if attempts == 1 {
+				competing := newCalculator(cmd.Id)
+				competing.add(100)
+				assert.NoError(t, session.Save(competing))
+			}
+			return decideAdd(agg, cmd)
+		})
+
+	agg, err := handler.Handle(session, addToCalculator{Id: "c1", Value: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, 101, agg.State().Value)
+}
+
+func TestCommandHandlerGivesUpAfterMaxRetries(t *testing.T) {
+	session := createEventSourcedSession(t)
+	defer session.Close()
+	attempts := 0
+	handler := NewCommandHandler(newCalculatorAggregate, addCommandId,
+		func(agg *Aggregate[calculatorState], cmd addToCalculator) ([]any, error) {
+			attempts++
+			competing := newCalculator(cmd.Id)
+			assert.NoError(t, session.LoadAggregate(competing))
+			competing.add(100)
+			assert.NoError(t, session.Save(competing))
+			return decideAdd(agg, cmd)
+		}, WithMaxRetries[addToCalculator, calculatorState](1))
+
+	_, err := handler.Handle(session, addToCalculator{Id: "c1", Value: 1})
+	assert.ErrorIs(t, err, ErrConcurrencyConflict)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestCommandBusDispatch(t *testing.T) {
+	session := createEventSourcedSession(t)
+	defer session.Close()
+	bus := NewCommandBus()
+	err := RegisterCommandHandler(bus, NewCommandHandler(newCalculatorAggregate, addCommandId, decideAdd))
+	assert.NoError(t, err)
+	err = RegisterCommandHandler(bus, NewCommandHandler(newCalculatorAggregate, resetCommandId,
+		func(agg *Aggregate[calculatorState], cmd resetCalculator) ([]any, error) {
+			return []any{calculator_updated_v1{Value: 0}}, nil
+		}))
+	assert.NoError(t, err)
+
+	assert.NoError(t, bus.Dispatch(session, addToCalculator{Id: "c1", Value: 5}))
+	assert.NoError(t, bus.Dispatch(session, resetCalculator{Id: "c1"}))
+
+	calc := newCalculator("c1")
+	assert.NoError(t, session.LoadAggregate(calc))
+	assert.Equal(t, 0, calc.State().Value)
+	assert.Equal(t, Version(2), calc.Version())
+
+	err = bus.Dispatch(session, "unknown")
+	assert.ErrorIs(t, err, ErrNoCommandHandler)
+
+	err = RegisterCommandHandler(bus, NewCommandHandler(newCalculatorAggregate, addCommandId, decideAdd))
+	assert.Error(t, err)
+}
@@ -0,0 +1,143 @@
+package moments
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+type CompressionAlgorithm byte
+
+const (
+	NoCompression CompressionAlgorithm = iota
+	Gzip
+	Zlib
+	Flate
+)
+
+func (a CompressionAlgorithm) String() string {
+	switch a {
+	case NoCompression:
+		return "None"
+	case Gzip:
+		return "Gzip"
+	case Zlib:
+		return "Zlib"
+	case Flate:
+		return "Flate"
+	default:
+		return "Unknown"
+	}
+}
+
+// compressionMagic begins every record written by Compression and is followed by a byte
+// naming the algorithm. A single header byte is not enough to tell compressed records from
+// uncompressed ones, as gob records can begin with any byte.
+const compressionMagic = "MCMP\x01"
+
+type CompressionOptions struct {
+	Algorithm CompressionAlgorithm
+	// Threshold is the payload size in bytes below which payloads are stored uncompressed.
+	Threshold int
+	// Level is the compression level passed to the algorithm. Defaults to the algorithm's default.
+	Level int
+}
+
+// Compression is a PayloadCodec compressing event data and snapshot state. Every record
+// it writes starts with a header naming the algorithm, so records compressed with
+// different settings, and records written before compression was enabled, can be read.
+// When combined with EnvelopeEncryption it must come first in Config.PayloadCodecs, as
+// encrypted payloads do not compress.
+type Compression struct {
+	// Default applies to aggregate types without options of their own.
+	Default CompressionOptions
+	// AggregateTypes overrides the options for individual aggregate types.
+	AggregateTypes map[AggregateType]CompressionOptions
+}
+
+func NewCompression(options CompressionOptions) *Compression {
+	return &Compression{Default: options, AggregateTypes: map[AggregateType]CompressionOptions{}}
+}
+
+func (c *Compression) options(aggregateType AggregateType) CompressionOptions {
+	if options, ok := c.AggregateTypes[aggregateType]; ok {
+		return options
+	}
+	return c.Default
+}
+
+func (c *Compression) Encode(info PayloadInfo, data []byte) ([]byte, error) {
+	options := c.options(info.StreamId.StreamType)
+	algorithm := options.Algorithm
+	if len(data) < options.Threshold {
+		algorithm = NoCompression
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(compressionMagic)
+	buf.WriteByte(byte(algorithm))
+	if algorithm == NoCompression {
+		buf.Write(data)
+		return buf.Bytes(), nil
+	}
+	writer, err := newCompressor(&buf, algorithm, options.Level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *Compression) Decode(info PayloadInfo, data []byte) ([]byte, error) {
+	if len(data) <= len(compressionMagic) || !bytes.HasPrefix(data, []byte(compressionMagic)) {
+		return data, nil
+	}
+	algorithm := CompressionAlgorithm(data[len(compressionMagic)])
+	data = data[len(compressionMagic)+1:]
+	if algorithm == NoCompression {
+		return data, nil
+	}
+	reader, err := newDecompressor(bytes.NewReader(data), algorithm)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func newCompressor(w io.Writer, algorithm CompressionAlgorithm, level int) (io.WriteCloser, error) {
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	switch algorithm {
+	case Gzip:
+		return gzip.NewWriterLevel(w, level)
+	case Zlib:
+		return zlib.NewWriterLevel(w, level)
+	case Flate:
+		return flate.NewWriter(w, level)
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm %v", algorithm)
+	}
+}
+
+func newDecompressor(r io.Reader, algorithm CompressionAlgorithm) (io.ReadCloser, error) {
+	switch algorithm {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zlib:
+		return zlib.NewReader(r)
+	case Flate:
+		return flate.NewReader(r), nil
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm %v", algorithm)
+	}
+}
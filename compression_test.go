@@ -0,0 +1,94 @@
+package moments
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compressionHeader(algorithm CompressionAlgorithm) []byte {
+	return append([]byte(compressionMagic), byte(algorithm))
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"Value":1}`), 100)
+	info := PayloadInfo{Kind: SnapshotPayload, StreamId: StreamId{Id: "c1", StreamType: calculatorType}}
+	for _, algorithm := range []CompressionAlgorithm{NoCompression, Gzip, Zlib, Flate} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			codec := NewCompression(CompressionOptions{Algorithm: algorithm})
+			encoded, err := codec.Encode(info, data)
+			require.NoError(t, err)
+			assert.Equal(t, compressionHeader(algorithm), encoded[:len(compressionMagic)+1])
+			if algorithm != NoCompression {
+				assert.Less(t, len(encoded), len(data))
+			}
+			decoded, err := codec.Decode(info, encoded)
+			require.NoError(t, err)
+			assert.Equal(t, data, decoded)
+		})
+	}
+}
+
+func TestCompressionThresholdAndAggregateOverrides(t *testing.T) {
+	codec := NewCompression(CompressionOptions{Algorithm: Gzip, Threshold: 100})
+	codec.AggregateTypes["Audit"] = CompressionOptions{Algorithm: NoCompression}
+	small := []byte(`{"Value":1}`)
+	large := bytes.Repeat(small, 20)
+
+	encoded, err := codec.Encode(PayloadInfo{StreamId: StreamId{StreamType: calculatorType}}, small)
+	require.NoError(t, err)
+	assert.Equal(t, compressionHeader(NoCompression), encoded[:len(compressionMagic)+1])
+
+	encoded, err = codec.Encode(PayloadInfo{StreamId: StreamId{StreamType: calculatorType}}, large)
+	require.NoError(t, err)
+	assert.Equal(t, compressionHeader(Gzip), encoded[:len(compressionMagic)+1])
+
+	encoded, err = codec.Encode(PayloadInfo{StreamId: StreamId{StreamType: "Audit"}}, large)
+	require.NoError(t, err)
+	assert.Equal(t, compressionHeader(NoCompression), encoded[:len(compressionMagic)+1])
+}
+
+func TestCompressionWithStoreReadsUncompressedRecords(t *testing.T) {
+	session, store := createEncryptedSession(t)
+	calc := newCalculator("c1")
+	calc.update(1)
+	require.NoError(t, session.Save(calc))
+
+	// Enable compression, then encryption, on a store holding uncompressed records
+	store.config.PayloadCodecs = []PayloadCodec{
+		NewCompression(CompressionOptions{Algorithm: Gzip}),
+		NewEnvelopeEncryption(NewMemoryKeyring("k1", testKey(1))),
+	}
+	calc = newCalculator("c1")
+	require.NoError(t, session.LoadAggregate(calc))
+	calc.add(2)
+	require.NoError(t, session.Save(calc))
+
+	_, encrypted := EnvelopeKeyId(store.state.eventData[2])
+	assert.True(t, encrypted)
+	loaded := newCalculator("c1")
+	require.NoError(t, session.LoadAggregate(loaded))
+	assert.Equal(t, 3, loaded.State().Value)
+	events, err := session.LoadStream(calc.StreamId())
+	require.NoError(t, err)
+	assert.Equal(t, []any{calculator_updated_v1{Value: 1}, calculator_added_v1{Value: 2}},
+		mapSlice(events, func(e PersistedEvent) any { return e.Data }))
+}
+
+type gobRecord struct {
+	CustomerName, CustomerEmail, ShippingAddress, BillingAddress, PhoneNumber, LoyaltyTier, PreferredLanguage string
+}
+
+func TestCompressionPassesThroughUncompressedGobRecords(t *testing.T) {
+	// Gob writes lengths of 128 or more with a leading 0xFE or 0xFF byte
+	raw, err := gobMarshal(gobRecord{CustomerName: "Alice", PreferredLanguage: "en"})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, raw[0], byte(0xF5))
+
+	codec := NewCompression(CompressionOptions{Algorithm: Gzip})
+	decoded, err := codec.Decode(PayloadInfo{}, raw)
+	require.NoError(t, err)
+	assert.Equal(t, raw, decoded)
+}
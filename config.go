@@ -1,12 +1,130 @@
 package moments
 
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
 type Config struct {
-	Aggregates map[AggregateType]AggregateConfig
+	Aggregates         map[AggregateType]AggregateConfig
 	SnapshotSerialiser *SnapshotSerialiser
-	EventDeserialiser *EventDeserialiser
-
+	EventDeserialiser  *EventDeserialiser
+	// EventSerialisers selects the serialiser events of a type are written with.
+	EventSerialisers map[EventType]*EventSerialiser
+	// DefaultEventSerialiser writes events of types without a serialiser of their own.
+	// Defaults to JsonEventSerialiser.
+	DefaultEventSerialiser *EventSerialiser
+	// Clock is used to timestamp events. Defaults to SystemClock.
+	Clock Clock
+	// IdGenerator creates aggregate and event ids for factories returned by RegisterAggregate,
+	// for Session.NewEvent and for events applied to aggregates loaded or saved by a session
+	// that were created without an IdGenerator of their own. Defaults to UUIDv7Generator.
+	// Aggregates from NewAggregateFactory take their id from UUIDv7Generator as they are
+	// created, and NewEvent always uses UUIDv7Generator. The generator is shared by every
+	// aggregate and session, so it must be safe for concurrent use and not tied to a single
+	// name like those of NewNameBasedIdGenerator.
+	IdGenerator IdGenerator
+	// SaveMiddleware runs in order on every event a session saves, before it is passed to the store.
+	SaveMiddleware []EventMiddleware
+	// LoadMiddleware runs in order on every event a session loads, after the store returns it.
+	LoadMiddleware []EventMiddleware
+	// Tracer starts spans around session, snapshot and store operations. Defaults to NoopTracer.
+	Tracer Tracer
+	// PayloadCodecs transform serialised event data and snapshot state as stores write them,
+	// in order, and are reversed as stores read them.
+	PayloadCodecs []PayloadCodec
+	// Signer signs events as stores append them. Unsigned when nil.
+	Signer Signer
+	// SignatureVerifier verifies the signatures of loaded events.
+	SignatureVerifier SignatureVerifier
+	// SignatureVerification sets how stores treat loaded events whose signature
+	// fails verification. Defaults to IgnoreSignatures.
+	SignatureVerification SignatureVerification
 }
 type AggregateConfig struct {
 	StoreStrategy     storeStrategyType
 	SnapshotFrequency int
+	// EventTypes lists the events the aggregate produces. Each must be resolvable
+	// by the EventDeserialiser when a SessionProvider is created.
+	EventTypes []EventType
+}
+
+// validate checks that every aggregate uses a known store strategy and that
+// every event type referenced by an aggregate can be deserialised.
+func (c *Config) validate() error {
+	var errs []error
+	for aggregateType, aggregateConfig := range c.Aggregates {
+		if _, ok := storeStrategies[aggregateConfig.StoreStrategy]; !ok {
+			errs = append(errs, fmt.Errorf("aggregate %v has unknown store strategy %v",
+				aggregateType, aggregateConfig.StoreStrategy))
+		}
+		for _, eventType := range aggregateConfig.EventTypes {
+			if c.EventDeserialiser == nil || !c.EventDeserialiser.canDeserialise(eventType) {
+				errs = append(errs, fmt.Errorf("aggregate %v has no deserialiser for event type %v",
+					aggregateType, eventType.Id))
+			}
+		}
+	}
+	if c.SignatureVerification != IgnoreSignatures && c.SignatureVerifier == nil {
+		errs = append(errs, fmt.Errorf("signature verification %v requires a SignatureVerifier",
+			c.SignatureVerification))
+	}
+	for eventType, serialiser := range c.EventSerialisers {
+		if serialiser.ContentType == "" {
+			errs = append(errs, fmt.Errorf("serialiser for event type %v has no content type", eventType.Id))
+			continue
+		}
+		if serialiser.ContentType == JsonContentType {
+			continue
+		}
+		var ok bool
+		if c.EventDeserialiser != nil {
+			_, ok = c.EventDeserialiser.goType(eventType)
+		}
+		if !ok {
+			errs = append(errs, fmt.Errorf("event type %v has no Go type to decode %v into",
+				eventType.Id, serialiser.ContentType))
+		}
+	}
+	errs = append(errs, c.validateContentTypes()...)
+	return errors.Join(errs...)
+}
+
+// validateContentTypes checks that each content type is written by a single serialiser,
+// as events are read back with the serialiser their content type names.
+func (c *Config) validateContentTypes() []error {
+	var errs []error
+	serialisers := map[string]*EventSerialiser{
+		JsonContentType: &JsonEventSerialiser,
+		GobContentType:  &GobEventSerialiser,
+	}
+	for _, serialiser := range append(slices.Collect(maps.Values(c.EventSerialisers)), c.DefaultEventSerialiser) {
+		if serialiser == nil || serialiser.ContentType == "" {
+			continue
+		}
+		if existing, ok := serialisers[serialiser.ContentType]; ok && existing != serialiser {
+			errs = append(errs, fmt.Errorf("more than one event serialiser has content type %v",
+				serialiser.ContentType))
+			continue
+		}
+		serialisers[serialiser.ContentType] = serialiser
+	}
+	return errs
+}
+
+func (c *Config) idGenerator() IdGenerator {
+	if c.IdGenerator == nil {
+		return UUIDv7Generator
+	}
+	return c.IdGenerator
+}
+
+func (c *Config) now() time.Time {
+	if c.Clock == nil {
+		return SystemClock.Now()
+	}
+	return c.Clock.Now()
 }
@@ -0,0 +1,39 @@
+package moments
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSessionProviderValidatesEventTypes(t *testing.T) {
+	addedType, err := GetEventType(calculator_added_v1{})
+	assert.NoError(t, err)
+	config := Config{
+		Aggregates: map[AggregateType]AggregateConfig{
+			calculatorType: {EventTypes: []EventType{*addedType}},
+		},
+		EventDeserialiser: createEventDeserialiser(),
+	}
+	_, err = NewSessionProvider(NewMemoryStoreProvider(&config), config)
+	assert.NoError(t, err)
+
+	empty := NewEventDeserialiser()
+	config.EventDeserialiser = &empty
+	_, err = NewSessionProvider(NewMemoryStoreProvider(&config), config)
+	assert.ErrorContains(t, err, "calculator_added_v1")
+
+	config.EventDeserialiser = nil
+	_, err = NewSessionProvider(NewMemoryStoreProvider(&config), config)
+	assert.Error(t, err)
+}
+
+func TestNewSessionProviderValidatesStoreStrategy(t *testing.T) {
+	config := Config{
+		Aggregates: map[AggregateType]AggregateConfig{
+			calculatorType: {StoreStrategy: storeStrategyType(99)},
+		},
+	}
+	_, err := NewSessionProvider(NewMemoryStoreProvider(&config), config)
+	assert.ErrorContains(t, err, "unknown store strategy")
+}
@@ -0,0 +1,162 @@
+package moments
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// encryptedPrefix marks a personal data field holding ciphertext.
+const encryptedPrefix = "moments:enc:v1:"
+
+// CryptoShredder encrypts personal data in events with a key per subject, so the data
+// can be erased by deleting the subject's key while the events themselves are kept.
+//
+// Personal data fields are string fields of an event struct tagged `moments:"personal"`.
+// The subject is read from the string field tagged `moments:"subject"`, or is the event's
+// stream id when no field is tagged. Add SaveMiddleware and LoadMiddleware to the Config.
+//
+// Snapshots hold decrypted aggregate state, so snapshots of aggregates holding a forgotten
+// subject's data should be deleted as well.
+//
+// The middleware runs in the session, so personal data is encrypted once, on the node saving
+// it, and replicated encrypted. Every node of a RaftStoreProvider cluster must therefore use
+// the same KeyStore: a node with a key store of its own cannot decrypt data saved through
+// other nodes, and would keep data readable after ForgetSubject deleted the shared key.
+type CryptoShredder struct {
+	Keys KeyStore
+	// Erased replaces personal data fields whose subject has been forgotten. Defaults to "".
+	Erased string
+}
+
+func NewCryptoShredder(keys KeyStore) *CryptoShredder {
+	return &CryptoShredder{Keys: keys}
+}
+
+// ForgetSubject deletes the subject's key, making its personal data unreadable.
+// Saving personal data for the subject afterwards fails with ErrSubjectForgotten.
+func (c *CryptoShredder) ForgetSubject(subject SubjectId) error {
+	return c.Keys.DeleteKey(subject)
+}
+
+// SaveMiddleware encrypts the personal data fields of events being saved.
+func (c *CryptoShredder) SaveMiddleware() EventMiddleware {
+	return func(ctx context.Context, event *PersistedEvent) error {
+		return c.transform(event, func(subject SubjectId, value string) (string, error) {
+			if value == "" || strings.HasPrefix(value, encryptedPrefix) {
+				return value, nil
+			}
+			key, err := c.Keys.GetOrCreateKey(subject)
+			if err != nil {
+				return "", err
+			}
+			return encryptString(key, subject, value)
+		})
+	}
+}
+
+// LoadMiddleware decrypts the personal data fields of loaded events, replacing the fields
+// of forgotten subjects with Erased.
+func (c *CryptoShredder) LoadMiddleware() EventMiddleware {
+	return func(ctx context.Context, event *PersistedEvent) error {
+		return c.transform(event, func(subject SubjectId, value string) (string, error) {
+			if !strings.HasPrefix(value, encryptedPrefix) {
+				return value, nil
+			}
+			key, err := c.Keys.Key(subject)
+			if errors.Is(err, ErrKeyNotFound) {
+				return c.Erased, nil
+			}
+			if err != nil {
+				return "", err
+			}
+			return decryptString(key, subject, value)
+		})
+	}
+}
+
+// transform applies fn to each personal data field of the event, replacing its Data
+// with a modified copy.
+func (c *CryptoShredder) transform(event *PersistedEvent, fn func(SubjectId, string) (string, error)) error {
+	value := reflect.ValueOf(event.Data)
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	fields, subjectField, err := personalDataFields(value.Type())
+	if err != nil || len(fields) == 0 {
+		return err
+	}
+
+	data := reflect.New(value.Type())
+	data.Elem().Set(value)
+	subject := SubjectId(event.StreamId.String())
+	if subjectField >= 0 {
+		subject = SubjectId(data.Elem().Field(subjectField).String())
+	}
+	for _, i := range fields {
+		field := data.Elem().Field(i)
+		result, err := fn(subject, field.String())
+		if err != nil {
+			return fmt.Errorf("personal data field %v of %v: %w", value.Type().Field(i).Name, value.Type(), err)
+		}
+		field.SetString(result)
+	}
+	event.Data = data.Elem().Interface()
+	return nil
+}
+
+// personalDataFields returns the indexes of the struct's personal data fields and of its
+// subject field, or -1 when it has none.
+func personalDataFields(ty reflect.Type) ([]int, int, error) {
+	var fields []int
+	subjectField := -1
+	for i := range ty.NumField() {
+		field := ty.Field(i)
+		tag := field.Tag.Get("moments")
+		if tag != "personal" && tag != "subject" {
+			continue
+		}
+		if field.Type.Kind() != reflect.String || !field.IsExported() {
+			return nil, -1, fmt.Errorf("field %v of %v tagged %v must be an exported string", field.Name, ty, tag)
+		}
+		if tag == "subject" {
+			subjectField = i
+		} else {
+			fields = append(fields, i)
+		}
+	}
+	return fields, subjectField, nil
+}
+
+func encryptString(key []byte, subject SubjectId, value string) (string, error) {
+	sealed, err := seal(key, []byte(value), []byte(subject))
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptString(key []byte, subject SubjectId, value string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", err
+	}
+	plain, err := open(key, sealed, []byte(subject))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
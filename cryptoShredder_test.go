@@ -0,0 +1,119 @@
+package moments
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type customer_registered_v1 struct {
+	CustomerId string `moments:"subject"`
+	Name       string `moments:"personal"`
+	Email      string `moments:"personal"`
+	Plan       string
+}
+
+type customer_renamed_v1 struct {
+	Name string `moments:"personal"`
+}
+
+func createShreddingSession(t *testing.T, shredder *CryptoShredder) *Session {
+	deserialiser := NewEventDeserialiser()
+	require.NoError(t, AddJsonEventDeserialiser[customer_registered_v1](deserialiser))
+	require.NoError(t, AddJsonEventDeserialiser[customer_renamed_v1](deserialiser))
+	return createSession(t, Config{
+		EventDeserialiser: &deserialiser,
+		SaveMiddleware:    []EventMiddleware{shredder.SaveMiddleware()},
+		LoadMiddleware:    []EventMiddleware{shredder.LoadMiddleware()},
+	})
+}
+
+func saveCustomerEvents(t *testing.T, session *Session, id string, events ...any) {
+	require.NoError(t, saveCustomer(session, id, Version(len(events)), events...))
+}
+
+func saveCustomer(session *Session, id string, version Version, events ...any) error {
+	return session.saveEvents(session.Context, StreamId{Id: id, StreamType: "customer"},
+		mapSlice(events, func(data any) Event { return NewEvent(data, nil) }), version)
+}
+
+func TestCryptoShredderEncryptsPersonalData(t *testing.T) {
+	shredder := NewCryptoShredder(NewMemoryKeyStore())
+	session := createShreddingSession(t, shredder)
+	registered := customer_registered_v1{CustomerId: "c1", Name: "Alice", Email: "alice@example.com", Plan: "pro"}
+	saveCustomerEvents(t, session, "c1", registered)
+
+	raw := string(session.Store.(*MemoryStore).state.eventData[1])
+	assert.NotContains(t, raw, "Alice")
+	assert.NotContains(t, raw, "alice@example.com")
+	assert.Contains(t, raw, "pro")
+
+	events, err := session.LoadEvents(LoadEventArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, registered, events[0].Data)
+}
+
+func TestCryptoShredderForgetSubjectErasesPersonalData(t *testing.T) {
+	shredder := NewCryptoShredder(NewMemoryKeyStore())
+	shredder.Erased = "[erased]"
+	session := createShreddingSession(t, shredder)
+	saveCustomerEvents(t, session, "c1",
+		customer_registered_v1{CustomerId: "c1", Name: "Alice", Plan: "pro"})
+	saveCustomerEvents(t, session, "c2",
+		customer_registered_v1{CustomerId: "c2", Name: "Bob", Plan: "free"})
+
+	require.NoError(t, shredder.ForgetSubject("c1"))
+
+	events, err := session.LoadEvents(LoadEventArgs{})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, customer_registered_v1{CustomerId: "c1", Name: "[erased]", Plan: "pro"}, events[0].Data)
+	assert.Equal(t, Version(1), events[0].Version)
+	assert.Equal(t, customer_registered_v1{CustomerId: "c2", Name: "Bob", Plan: "free"}, events[1].Data)
+}
+
+func TestCryptoShredderUsesStreamIdWithoutSubjectField(t *testing.T) {
+	shredder := NewCryptoShredder(NewMemoryKeyStore())
+	session := createShreddingSession(t, shredder)
+	saveCustomerEvents(t, session, "c1", customer_renamed_v1{Name: "Alice"})
+
+	events, err := session.LoadEvents(LoadEventArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, customer_renamed_v1{Name: "Alice"}, events[0].Data)
+
+	subject := SubjectId(StreamId{Id: "c1", StreamType: "customer"}.String())
+	require.NoError(t, shredder.ForgetSubject(subject))
+	events, err = session.LoadEvents(LoadEventArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, customer_renamed_v1{}, events[0].Data)
+}
+
+func TestCryptoShredderRejectsNonStringPersonalData(t *testing.T) {
+	type invalid struct {
+		Age int `moments:"personal"`
+	}
+	_, _, err := personalDataFields(reflect.TypeFor[invalid]())
+	assert.Error(t, err)
+}
+
+func TestCryptoShredderRejectsPersonalDataOfForgottenSubjects(t *testing.T) {
+	shredder := NewCryptoShredder(NewMemoryKeyStore())
+	shredder.Erased = "[erased]"
+	session := createShreddingSession(t, shredder)
+	saveCustomerEvents(t, session, "c1",
+		customer_registered_v1{CustomerId: "c1", Name: "Alice", Plan: "pro"})
+	require.NoError(t, shredder.ForgetSubject("c1"))
+
+	err := saveCustomer(session, "c1", 2, customer_registered_v1{CustomerId: "c1", Name: "Alice Smith", Plan: "pro"})
+	assert.ErrorIs(t, err, ErrSubjectForgotten)
+	require.NoError(t, saveCustomer(session, "c1", 2, customer_registered_v1{CustomerId: "c1", Plan: "free"}))
+
+	events, err := session.LoadEvents(LoadEventArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, []any{
+		customer_registered_v1{CustomerId: "c1", Name: "[erased]", Plan: "pro"},
+		customer_registered_v1{CustomerId: "c1", Plan: "free"},
+	}, mapSlice(events, func(e PersistedEvent) any { return e.Data }))
+}
@@ -0,0 +1,198 @@
+package moments
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// envelopeMagic prefixes payloads encrypted by EnvelopeEncryption.
+var envelopeMagic = []byte("MENC\x01")
+
+// ErrMalformedEnvelope is returned when an encrypted payload cannot be parsed.
+var ErrMalformedEnvelope = errors.New("malformed encrypted payload")
+
+// ErrUnencryptedPayload is returned by EnvelopeEncryption with RequireEncrypted when a
+// payload it reads was not encrypted.
+var ErrUnencryptedPayload = errors.New("payload is not encrypted")
+
+// Keyring holds the master keys used to wrap data keys. Every key that has wrapped a
+// stored record must remain available for the record to be read.
+type Keyring interface {
+	// CurrentKey returns the id and value of the key new records are encrypted with.
+	CurrentKey() (string, []byte, error)
+	// Key returns the key with the given id or ErrKeyNotFound.
+	Key(id string) ([]byte, error)
+}
+
+// MemoryKeyring is a Keyring holding 256 bit master keys in memory.
+type MemoryKeyring struct {
+	mu      sync.RWMutex
+	current string
+	keys    map[string][]byte
+}
+
+// NewMemoryKeyring creates a keyring whose current key has the given id and value.
+func NewMemoryKeyring(id string, key []byte) *MemoryKeyring {
+	return &MemoryKeyring{current: id, keys: map[string][]byte{id: key}}
+}
+
+// Rotate adds a key and makes it current. Records encrypted with earlier keys stay readable.
+func (k *MemoryKeyring) Rotate(id string, key []byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[id] = key
+	k.current = id
+}
+
+func (k *MemoryKeyring) CurrentKey() (string, []byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current, k.keys[k.current], nil
+}
+
+func (k *MemoryKeyring) Key(id string) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrKeyNotFound, id)
+	}
+	return key, nil
+}
+
+// EnvelopeEncryption is a PayloadCodec encrypting each payload with a fresh data key,
+// which is in turn encrypted with the keyring's current master key. The master key's id
+// is stored in the record so keys can be rotated without rewriting existing records.
+// Payloads are bound to their kind, stream and version, so records cannot be swapped
+// between or within streams undetected.
+//
+// Payloads without the magic header are returned as they are, so records written before
+// encryption was enabled remain readable. As anyone able to write to the store can then
+// supply plaintext, set RequireEncrypted once every record has been encrypted.
+//
+// Records are laid out as the magic header, the key id length and key id, the wrapped
+// data key length and wrapped data key, then the nonce and sealed payload.
+type EnvelopeEncryption struct {
+	Keyring Keyring
+	// RequireEncrypted rejects payloads that were not encrypted with ErrUnencryptedPayload.
+	RequireEncrypted bool
+}
+
+func NewEnvelopeEncryption(keyring Keyring) *EnvelopeEncryption {
+	return &EnvelopeEncryption{Keyring: keyring}
+}
+
+func (e *EnvelopeEncryption) Encode(info PayloadInfo, data []byte) ([]byte, error) {
+	keyId, masterKey, err := e.Keyring.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(keyId) > 255 {
+		return nil, fmt.Errorf("key id %v is longer than 255 bytes", keyId)
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	wrappedKey, err := seal(masterKey, dataKey, []byte(keyId))
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := seal(dataKey, data, envelopeAdditionalData(info))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(envelopeMagic)
+	buf.WriteByte(byte(len(keyId)))
+	buf.WriteString(keyId)
+	buf.Write(binary.BigEndian.AppendUint16(nil, uint16(len(wrappedKey))))
+	buf.Write(wrappedKey)
+	buf.Write(sealed)
+	return buf.Bytes(), nil
+}
+
+func (e *EnvelopeEncryption) Decode(info PayloadInfo, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, envelopeMagic) {
+		if e.RequireEncrypted {
+			return nil, ErrUnencryptedPayload
+		}
+		return data, nil
+	}
+	keyId, wrappedKey, sealed, err := parseEnvelope(data[len(envelopeMagic):])
+	if err != nil {
+		return nil, err
+	}
+	masterKey, err := e.Keyring.Key(keyId)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := open(masterKey, wrappedKey, []byte(keyId))
+	if err != nil {
+		return nil, err
+	}
+	return open(dataKey, sealed, envelopeAdditionalData(info))
+}
+
+// EnvelopeKeyId returns the id of the master key an encrypted payload was written with.
+func EnvelopeKeyId(data []byte) (string, bool) {
+	if !bytes.HasPrefix(data, envelopeMagic) {
+		return "", false
+	}
+	keyId, _, _, err := parseEnvelope(data[len(envelopeMagic):])
+	return keyId, err == nil
+}
+
+func parseEnvelope(data []byte) (string, []byte, []byte, error) {
+	if len(data) < 1 {
+		return "", nil, nil, ErrMalformedEnvelope
+	}
+	keyIdLen := int(data[0])
+	data = data[1:]
+	if len(data) < keyIdLen+2 {
+		return "", nil, nil, ErrMalformedEnvelope
+	}
+	keyId := string(data[:keyIdLen])
+	data = data[keyIdLen:]
+	wrappedLen := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	if len(data) < wrappedLen {
+		return "", nil, nil, ErrMalformedEnvelope
+	}
+	return keyId, data[:wrappedLen], data[wrappedLen:], nil
+}
+
+func envelopeAdditionalData(info PayloadInfo) []byte {
+	return fmt.Appendf(nil, "%v/%v/%v", info.Kind, info.StreamId, info.Version)
+}
+
+// seal encrypts data with AES-GCM, prefixing the random nonce.
+func seal(key []byte, data []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, data, additionalData), nil
+}
+
+// open decrypts data sealed by seal.
+func open(key []byte, sealed []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrMalformedEnvelope
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
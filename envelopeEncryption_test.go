@@ -0,0 +1,123 @@
+package moments
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createEncryptedSession(t *testing.T, codecs ...PayloadCodec) (*Session, *MemoryStore) {
+	session := createSession(t, Config{
+		Aggregates: map[AggregateType]AggregateConfig{
+			calculatorType: {StoreStrategy: alwaysSnapshot},
+		},
+		EventDeserialiser: createEventDeserialiser(),
+		PayloadCodecs:     codecs,
+	})
+	return session, session.Store.(*MemoryStore)
+}
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestEnvelopeEncryptionEncryptsEventsAndSnapshots(t *testing.T) {
+	session, store := createEncryptedSession(t, NewEnvelopeEncryption(NewMemoryKeyring("k1", testKey(1))))
+	calc := newCalculator("c1")
+	calc.update(12345)
+	require.NoError(t, session.Save(calc))
+
+	raw := store.state.eventData[1]
+	assert.NotContains(t, string(raw), "12345")
+	keyId, ok := EnvelopeKeyId(raw)
+	assert.True(t, ok)
+	assert.Equal(t, "k1", keyId)
+	rawSnapshot := store.state.snapshots[NewSnapshotId(calc.StreamId(), calc.SchemaVersion())]
+	assert.NotContains(t, string(rawSnapshot.State), "12345")
+
+	loaded := newCalculator("c1")
+	require.NoError(t, session.LoadAggregate(loaded))
+	assert.Equal(t, 12345, loaded.State().Value)
+	events, err := session.LoadStream(calc.StreamId())
+	require.NoError(t, err)
+	assert.Equal(t, calculator_updated_v1{Value: 12345}, events[0].Data)
+}
+
+func TestEnvelopeEncryptionReadsRecordsAfterKeyRotation(t *testing.T) {
+	keyring := NewMemoryKeyring("k1", testKey(1))
+	session, store := createEncryptedSession(t, NewEnvelopeEncryption(keyring))
+	calc := newCalculator("c1")
+	calc.update(1)
+	require.NoError(t, session.Save(calc))
+
+	keyring.Rotate("k2", testKey(2))
+	calc = newCalculator("c1")
+	require.NoError(t, session.LoadAggregate(calc))
+	calc.add(2)
+	require.NoError(t, session.Save(calc))
+
+	keyId, _ := EnvelopeKeyId(store.state.eventData[2])
+	assert.Equal(t, "k2", keyId)
+	events, err := session.LoadStream(calc.StreamId())
+	require.NoError(t, err)
+	assert.Equal(t, []any{calculator_updated_v1{Value: 1}, calculator_added_v1{Value: 2}},
+		mapSlice(events, func(e PersistedEvent) any { return e.Data }))
+}
+
+func TestEnvelopeEncryptionReadsUnencryptedRecords(t *testing.T) {
+	session, store := createEncryptedSession(t)
+	calc := newCalculator("c1")
+	calc.update(7)
+	require.NoError(t, session.Save(calc))
+
+	store.config.PayloadCodecs = []PayloadCodec{NewEnvelopeEncryption(NewMemoryKeyring("k1", testKey(1)))}
+	loaded := newCalculator("c1")
+	require.NoError(t, session.LoadAggregate(loaded))
+	assert.Equal(t, 7, loaded.State().Value)
+}
+
+func TestEnvelopeEncryptionRequireEncryptedRejectsUnencryptedRecords(t *testing.T) {
+	session, store := createEncryptedSession(t, NewEnvelopeEncryption(NewMemoryKeyring("k1", testKey(1))))
+	calc := newCalculator("c1")
+	calc.update(7)
+	require.NoError(t, session.Save(calc))
+
+	store.config.PayloadCodecs = nil
+	require.NoError(t, session.saveEvents(session.Context, calc.StreamId(),
+		[]Event{session.NewEvent(calculator_added_v1{Value: 1}, nil)}, 2))
+
+	codec := NewEnvelopeEncryption(NewMemoryKeyring("k1", testKey(1)))
+	codec.RequireEncrypted = true
+	store.config.PayloadCodecs = []PayloadCodec{codec}
+	_, err := session.LoadEvents(LoadEventArgs{StreamId: calc.StreamId(), ToVersion: 1})
+	assert.NoError(t, err)
+	_, err = session.LoadStream(calc.StreamId())
+	assert.ErrorIs(t, err, ErrUnencryptedPayload)
+}
+
+func TestEnvelopeEncryptionRejectsRecordsSwappedWithinStream(t *testing.T) {
+	session, store := createEncryptedSession(t, NewEnvelopeEncryption(NewMemoryKeyring("k1", testKey(1))))
+	calc := newCalculator("c1")
+	calc.update(7)
+	calc.update(8)
+	require.NoError(t, session.Save(calc))
+
+	data := store.state.eventData
+	data[1], data[2] = data[2], data[1]
+	_, err := session.LoadStream(calc.StreamId())
+	assert.Error(t, err)
+}
+
+func TestEnvelopeEncryptionRejectsRecordsFromOtherStreams(t *testing.T) {
+	codec := NewEnvelopeEncryption(NewMemoryKeyring("k1", testKey(1)))
+	encoded, err := codec.Encode(PayloadInfo{Kind: EventPayload, StreamId: StreamId{Id: "a"}}, []byte("data"))
+	require.NoError(t, err)
+
+	_, err = codec.Decode(PayloadInfo{Kind: EventPayload, StreamId: StreamId{Id: "b"}}, encoded)
+	assert.Error(t, err)
+	_, err = NewEnvelopeEncryption(NewMemoryKeyring("k2", testKey(2))).
+		Decode(PayloadInfo{Kind: EventPayload, StreamId: StreamId{Id: "a"}}, encoded)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
@@ -2,12 +2,11 @@ package moments
 
 import (
 	"fmt"
+	"maps"
 	"reflect"
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/danyo1399/gotils"
 )
 
 type (
@@ -22,22 +21,44 @@ type PersistedEvent struct {
 	StreamId       StreamId
 	Sequence       Sequence
 	GlobalSequence Sequence
-	CausationId    CausationId
 	CorrelationId  CorrelationId
-	Metadata       Metadata
 	EventType      EventType
 	Version        Version
-	Timestamp      time.Time
+	// ContentType is the content type of the serialiser the event's data was written with
+	ContentType string
+	// Hash chains the event to the events before it, see ChainVerifier
+	Hash string
+	// PreviousHash is the Hash of the previous event in the stream
+	PreviousHash string
+	// PreviousGlobalHash is the Hash of the previous event in the tenant's log
+	PreviousGlobalHash string
+	// SignatureKeyId identifies the key the event's Hash was signed with, see Signer
+	SignatureKeyId string
+	Signature      []byte
+	// Payload is the event's Data as written by its EventSerialiser. It is set on events read
+	// from a ReplicationFeed so they can be copied to another store byte for byte, keeping
+	// their Hash valid even when serialising Data again would give different bytes.
+	Payload []byte `json:",omitempty"`
 }
 
 type Event struct {
 	EventId EventId
 	Data    any
+	// Timestamp is when the event occurred. When left empty it is stamped from
+	// the configured Clock as the event is saved.
+	Timestamp time.Time
+	// CausationId is the id of the command or event that caused this event.
+	// When left empty the CausationId of the save is used.
+	CausationId CausationId
+	// Metadata is merged over the metadata of the save, with event values taking precedence.
+	Metadata Metadata
 }
 
 type ApplyArgs struct {
-	EventId   EventId
-	Timestamp time.Time
+	EventId     EventId
+	Timestamp   time.Time
+	CausationId CausationId
+	Metadata    Metadata
 }
 
 type EventType struct {
@@ -60,34 +81,52 @@ func getEventTypeFromName(id string) (*EventType, error) {
 	if err != nil {
 		return nil, fmt.Errorf("invalid event type version %v", parts[2])
 	}
-	return &EventType{
-		SchemaVersion: SchemaVersion(version),
-		AggregateType: gotils.ToSnakeCase(parts[0]),
-		Name:          gotils.ToSnakeCase(parts[1]),
-		Id:            id,
-	}, nil
+	eventType := NewEventType(parts[1], AggregateType(parts[0]), SchemaVersion(version))
+	return &eventType, nil
 }
 
+// GetEventType resolves the event type of an event value.
+// Types implementing EventTyper or registered with RegisterEvent are resolved first,
+// falling back to parsing the Go type name as Aggregate_Name_V1.
 func GetEventType(value any) (*EventType, error) {
+	if typer, ok := value.(EventTyper); ok {
+		eventType := typer.EventType()
+		return &eventType, nil
+	}
 	ty := reflect.TypeOf(value)
-	name := ty.Name()
-	return getEventTypeFromName(name)
+	if ty == nil {
+		return nil, fmt.Errorf("cannot get event type of nil value")
+	}
+	if eventType, ok := registry.eventType(ty); ok {
+		return &eventType, nil
+	}
+	return getEventTypeFromName(ty.Name())
 }
 
+// NewEvent creates an event with an id from UUIDv7Generator unless args has one.
+// Session.NewEvent uses the configured IdGenerator instead.
 func NewEvent(data any, args *ApplyArgs) Event {
+	return newEvent(data, args, UUIDv7Generator)
+}
+
+// newEvent creates an event, taking its id from idGenerator when args has none.
+func newEvent(data any, args *ApplyArgs, idGenerator IdGenerator) Event {
 	if args == nil {
 		args = &ApplyArgs{}
 	}
-	eventId := newSquentialString()
+	eventId := idGenerator.NewId()
 	evt := Event{
-		EventId: defaultIfEmpty(&args.EventId, EventId(eventId)),
-		Data:    data,
+		EventId:     defaultIfEmpty(&args.EventId, EventId(eventId)),
+		Data:        data,
+		Timestamp:   args.Timestamp,
+		CausationId: args.CausationId,
+		Metadata:    args.Metadata,
 	}
 	return evt
 }
 
 func (e *PersistedEvent) ToEvent() Event {
-	return Event{Data: e.Data, EventId: e.EventId}
+	return e.Event
 }
 
 func (e *Event) ToPersistedEvent(
@@ -106,12 +145,12 @@ func (e *Event) ToPersistedEvent(
 		EventType:      *eventType,
 		Version:        version,
 		CorrelationId:  correlationId,
-		CausationId:    causationId,
-		Metadata:       metadata,
-		Timestamp:      time.Now(),
 		Event: Event{
-			EventId: e.EventId,
-			Data:    e.Data,
+			EventId:     e.EventId,
+			Data:        e.Data,
+			Timestamp:   e.Timestamp,
+			CausationId: defaultIfEmpty(&e.CausationId, causationId),
+			Metadata:    mergeMetadata(metadata, e.Metadata),
 		},
 	}
 	return r
@@ -120,3 +159,13 @@ func (e *Event) ToPersistedEvent(
 func (e *Event) EventType() (*EventType, error) {
 	return GetEventType(e.Data)
 }
+
+// mergeMetadata returns a new map holding the entries of each metadata in turn,
+// with later entries overriding earlier ones.
+func mergeMetadata(metadata ...Metadata) Metadata {
+	merged := Metadata{}
+	for _, m := range metadata {
+		maps.Copy(merged, m)
+	}
+	return merged
+}
@@ -3,41 +3,89 @@ package moments
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
 )
 
 type (
 	EventDeserialiserFunc func(data []byte) (any, error)
-	EventDeserialiser     map[EventType]EventDeserialiserFunc
+	// EventDeserialiser holds the deserialisers for json event data by event type, and the
+	// Go types of events added with AddJsonEventDeserialiser so events written by other
+	// EventSerialisers can be decoded.
+	EventDeserialiser struct {
+		funcs   map[EventType]EventDeserialiserFunc
+		goTypes map[EventType]reflect.Type
+	}
 )
 
 func NewEventDeserialiser() EventDeserialiser {
-	return make(EventDeserialiser)
+	return EventDeserialiser{
+		funcs:   map[EventType]EventDeserialiserFunc{},
+		goTypes: map[EventType]reflect.Type{},
+	}
+}
+
+// Add sets the function json event data of the given type is deserialised with.
+// Events of the type can only be read by other EventSerialisers when their Go type
+// is registered with RegisterEvent.
+func (c EventDeserialiser) Add(eventType EventType, fn EventDeserialiserFunc) {
+	c.funcs[eventType] = fn
 }
 
 func (c *EventDeserialiser) Deserialise(eventType EventType, data []byte) (any, error) {
-	fn, ok := (*c)[eventType]
+	fn, ok := c.funcs[eventType]
+	if ok {
+		return fn(data)
+	}
+	// Fall back to types registered with RegisterEvent
+	ty, ok := registry.goType(eventType.Id)
 	if !ok {
 		return nil, fmt.Errorf("no deserialiser for event type %v", eventType)
 	}
-	return fn(data)
+	return jsonDeserialiserFunc(ty)(data)
+}
+
+func (c *EventDeserialiser) canDeserialise(eventType EventType) bool {
+	if _, ok := c.funcs[eventType]; ok {
+		return true
+	}
+	_, ok := registry.goType(eventType.Id)
+	return ok
+}
+
+// goType returns the Go type of an event type, either added to the deserialiser or
+// registered with RegisterEvent.
+func (c *EventDeserialiser) goType(eventType EventType) (reflect.Type, bool) {
+	if ty, ok := c.goTypes[eventType]; ok {
+		return ty, true
+	}
+	return registry.goType(eventType.Id)
 }
 
 // AddJsonEventDeserialiser creates a function that can be used to deserialise events.
 func AddJsonEventDeserialiser[T any](deserialiser EventDeserialiser) error {
-	fn := func(data []byte) (any, error) {
-		var val T
-		err := json.Unmarshal(data, &val)
+	_, err := addJsonEventDeserialiser(deserialiser, reflect.TypeFor[T]())
+	return err
+}
+
+// addJsonEventDeserialiser registers a json deserialiser for the given Go type and
+// returns the event type it was registered under.
+func addJsonEventDeserialiser(deserialiser EventDeserialiser, ty reflect.Type) (*EventType, error) {
+	eventType, err := GetEventType(reflect.Zero(ty).Interface())
+	if err != nil {
+		return nil, err
+	}
+	deserialiser.funcs[*eventType] = jsonDeserialiserFunc(ty)
+	deserialiser.goTypes[*eventType] = ty
+	return eventType, nil
+}
+
+func jsonDeserialiserFunc(ty reflect.Type) EventDeserialiserFunc {
+	return func(data []byte) (any, error) {
+		val := reflect.New(ty)
+		err := json.Unmarshal(data, val.Interface())
 		if err != nil {
 			return nil, err
 		}
-		return val, nil
-	}
-	var zero T
-
-	eventType, err := GetEventType(zero)
-	if err != nil {
-		return err
+		return val.Elem().Interface(), nil
 	}
-	deserialiser[*eventType] = fn
-	return nil
 }
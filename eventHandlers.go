@@ -0,0 +1,151 @@
+package moments
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// UnknownEventBehaviour controls what EventHandlers do with events that have no handler.
+type UnknownEventBehaviour int
+
+const (
+	// PanicOnUnknownEvent panics when an event has no handler.
+	PanicOnUnknownEvent UnknownEventBehaviour = iota
+	// IgnoreUnknownEvent skips events that have no handler.
+	IgnoreUnknownEvent
+	// ErrorOnUnknownEvent stops reducing and reports ErrUnknownEvent.
+	ErrorOnUnknownEvent
+)
+
+func (b UnknownEventBehaviour) String() string {
+	switch b {
+	case PanicOnUnknownEvent:
+		return "Panic"
+	case IgnoreUnknownEvent:
+		return "Ignore"
+	case ErrorOnUnknownEvent:
+		return "Error"
+	default:
+		return "Unknown"
+	}
+}
+
+var ErrUnknownEvent = errors.New("unknown event")
+
+// EventHandler applies events of a single type to a state.
+type EventHandler[T any] struct {
+	eventType reflect.Type
+	apply     func(state T, event any) T
+}
+
+// On creates a handler that applies events of type E to a state of type T.
+func On[T any, E any](fn func(state T, event E) T) EventHandler[T] {
+	return EventHandler[T]{
+		eventType: reflect.TypeFor[E](),
+		apply: func(state T, event any) T {
+			return fn(state, event.(E))
+		},
+	}
+}
+
+// EventHandlers dispatches events to typed handlers by their Go type.
+// It replaces hand written type switch reducers.
+type EventHandlers[T any] struct {
+	handlers      map[reflect.Type]EventHandler[T]
+	order         []reflect.Type
+	unknownEvents UnknownEventBehaviour
+}
+
+// NewEventHandlers creates a set of handlers that panics on unknown events.
+// It panics if more than one handler is given for the same event type.
+func NewEventHandlers[T any](handlers ...EventHandler[T]) *EventHandlers[T] {
+	h := EventHandlers[T]{handlers: map[reflect.Type]EventHandler[T]{}}
+	for _, handler := range handlers {
+		if _, exists := h.handlers[handler.eventType]; exists {
+			panic(fmt.Sprintln("duplicate handler for event type", handler.eventType))
+		}
+		h.handlers[handler.eventType] = handler
+		h.order = append(h.order, handler.eventType)
+	}
+	return &h
+}
+
+// OnUnknownEvent sets how events without a handler are treated.
+func (h *EventHandlers[T]) OnUnknownEvent(behaviour UnknownEventBehaviour) *EventHandlers[T] {
+	h.unknownEvents = behaviour
+	return h
+}
+
+// Reduce applies events to the state using the matching handlers.
+// With ErrorOnUnknownEvent it returns the state reached before the unknown event along with the error.
+func (h *EventHandlers[T]) Reduce(state T, events ...any) (T, error) {
+	for _, event := range events {
+		handler, ok := h.handlers[reflect.TypeOf(event)]
+		if ok {
+			state = handler.apply(state, event)
+			continue
+		}
+		switch h.unknownEvents {
+		case IgnoreUnknownEvent:
+		case ErrorOnUnknownEvent:
+			return state, fmt.Errorf("%w %T", ErrUnknownEvent, event)
+		default:
+			panic(fmt.Sprintln("unknown event type", event))
+		}
+	}
+	return state, nil
+}
+
+// Reducer adapts the handlers to a Reducer for use with an aggregate factory.
+// As a Reducer cannot return an error, ErrorOnUnknownEvent panics with ErrUnknownEvent,
+// which Aggregate recovers and returns from Apply and Load.
+func (h *EventHandlers[T]) Reducer() Reducer[T] {
+	return func(state T, events ...any) T {
+		state, err := h.Reduce(state, events...)
+		if err != nil {
+			panic(err)
+		}
+		return state
+	}
+}
+
+// recoverUnknownEvent turns a panic raised by a Reducer with ErrorOnUnknownEvent into an error.
+func recoverUnknownEvent(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if e, ok := r.(error); ok && errors.Is(e, ErrUnknownEvent) {
+		*err = e
+		return
+	}
+	panic(r)
+}
+
+// Handles reports whether there is a handler for the event's type.
+func (h *EventHandlers[T]) Handles(event any) bool {
+	_, ok := h.handlers[reflect.TypeOf(event)]
+	return ok
+}
+
+// Events returns a zero value of each handled event type in registration order.
+// The result can be passed to RegisterAggregate.
+func (h *EventHandlers[T]) Events() []any {
+	return mapSlice(h.order, func(ty reflect.Type) any {
+		return reflect.Zero(ty).Interface()
+	})
+}
+
+// EventTypes returns the event type of each handled event in registration order.
+func (h *EventHandlers[T]) EventTypes() ([]EventType, error) {
+	eventTypes := make([]EventType, 0, len(h.order))
+	for _, evt := range h.Events() {
+		eventType, err := GetEventType(evt)
+		if err != nil {
+			return nil, err
+		}
+		eventTypes = append(eventTypes, *eventType)
+	}
+	return eventTypes, nil
+}
@@ -0,0 +1,112 @@
+package moments
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventHandlersReduce(t *testing.T) {
+	state, err := calculatorHandlers.Reduce(calculatorState{},
+		calculator_updated_v1{Value: 5}, calculator_added_v1{Value: 3}, calculator_subtracted_v1{Value: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 7, state.Value)
+}
+
+func TestEventHandlersPanicOnUnknownEvent(t *testing.T) {
+	handlers := NewEventHandlers(On(func(state calculatorState, e calculator_added_v1) calculatorState {
+		state.Value += e.Value
+		return state
+	}))
+	assert.Panics(t, func() {
+		handlers.Reducer()(calculatorState{}, "unknown")
+	})
+}
+
+func TestEventHandlersIgnoreUnknownEvent(t *testing.T) {
+	handlers := NewEventHandlers(On(func(state calculatorState, e calculator_added_v1) calculatorState {
+		state.Value += e.Value
+		return state
+	})).OnUnknownEvent(IgnoreUnknownEvent)
+
+	state, err := handlers.Reduce(calculatorState{}, calculator_added_v1{Value: 1}, "unknown", calculator_added_v1{Value: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, state.Value)
+}
+
+func TestEventHandlersErrorOnUnknownEvent(t *testing.T) {
+	handlers := NewEventHandlers(On(func(state calculatorState, e calculator_added_v1) calculatorState {
+		state.Value += e.Value
+		return state
+	})).OnUnknownEvent(ErrorOnUnknownEvent)
+
+	state, err := handlers.Reduce(calculatorState{}, calculator_added_v1{Value: 1}, "unknown", calculator_added_v1{Value: 2})
+	assert.ErrorIs(t, err, ErrUnknownEvent)
+	assert.Equal(t, 1, state.Value)
+
+	assert.PanicsWithError(t, "unknown event string", func() {
+		handlers.Reducer()(calculatorState{}, calculator_added_v1{Value: 1}, "unknown")
+	})
+}
+
+func TestLoadingAggregateWithUnhandledEventReturnsError(t *testing.T) {
+	handlers := NewEventHandlers(On(func(state calculatorState, e calculator_added_v1) calculatorState {
+		state.Value += e.Value
+		return state
+	})).OnUnknownEvent(ErrorOnUnknownEvent)
+	newAggregate := NewAggregateFactory(calculatorType, initStateFunc, handlers.Reducer())
+
+	session := createEventSourcedSession(t)
+	calc := newCalculator("c1")
+	calc.add(1)
+	calc.subtract(2)
+	require.NoError(t, session.Save(calc))
+
+	loaded := &calculator{*newAggregate(WithId[calculatorState]("c1"))}
+	err := session.LoadAggregate(loaded)
+	assert.ErrorIs(t, err, ErrUnknownEvent)
+	err = session.LoadAggregateAt(&calculator{*newAggregate(WithId[calculatorState]("c1"))}, 2)
+	assert.ErrorIs(t, err, ErrUnknownEvent)
+}
+
+func TestApplyingUnhandledEventReturnsError(t *testing.T) {
+	handlers := NewEventHandlers(On(func(state calculatorState, e calculator_added_v1) calculatorState {
+		state.Value += e.Value
+		return state
+	})).OnUnknownEvent(ErrorOnUnknownEvent)
+	calc := NewAggregateFactory(calculatorType, initStateFunc, handlers.Reducer())()
+
+	_, err := calc.Apply(calculator_added_v1{Value: 1}, nil)
+	assert.NoError(t, err)
+	state, err := calc.Apply(calculator_subtracted_v1{Value: 2}, nil)
+	assert.ErrorIs(t, err, ErrUnknownEvent)
+	assert.Equal(t, 1, state.Value)
+	assert.Equal(t, Version(1), calc.Version())
+	assert.Len(t, calc.UnsavedEvents(), 1)
+
+	assert.ErrorIs(t, calc.Load([]any{calculator_added_v1{Value: 1}, calculator_subtracted_v1{Value: 2}}), ErrUnknownEvent)
+	assert.Equal(t, 1, calc.State().Value)
+	assert.Equal(t, Version(1), calc.Version())
+}
+
+func TestEventHandlersDuplicateHandlerPanics(t *testing.T) {
+	handler := On(func(state calculatorState, e calculator_added_v1) calculatorState {
+		return state
+	})
+	assert.Panics(t, func() {
+		NewEventHandlers(handler, handler)
+	})
+}
+
+func TestEventHandlersIntrospection(t *testing.T) {
+	assert.True(t, calculatorHandlers.Handles(calculator_added_v1{}))
+	assert.False(t, calculatorHandlers.Handles("unknown"))
+	assert.Equal(t, []any{calculator_added_v1{}, calculator_subtracted_v1{}, calculator_updated_v1{}},
+		calculatorHandlers.Events())
+
+	eventTypes, err := calculatorHandlers.EventTypes()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"calculator_added_v1", "calculator_subtracted_v1", "calculator_updated_v1"},
+		mapSlice(eventTypes, func(e EventType) string { return e.Id }))
+}
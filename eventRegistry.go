@@ -0,0 +1,82 @@
+package moments
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/danyo1399/gotils"
+)
+
+// EventTyper can be implemented by event structs to declare their event type
+// explicitly instead of relying on the type name convention.
+// The method must use a value receiver.
+type EventTyper interface {
+	EventType() EventType
+}
+
+type eventRegistry struct {
+	mu     sync.RWMutex
+	byType map[reflect.Type]EventType
+	byId   map[string]reflect.Type
+}
+
+// registry holds the event types registered with RegisterEvent.
+var registry = &eventRegistry{
+	byType: map[reflect.Type]EventType{},
+	byId:   map[string]reflect.Type{},
+}
+
+// NewEventType creates an event type with an id derived from its aggregate type, name and version.
+// The aggregate type and name are snake cased as they are for Go type names, so
+// NewEventType("Added", "Calculator", 1) and Calculator_Added_V1 share the id calculator_added_v1.
+func NewEventType(name string, aggregateType AggregateType, version SchemaVersion) EventType {
+	aggregate := gotils.ToSnakeCase(string(aggregateType))
+	name = gotils.ToSnakeCase(name)
+	return EventType{
+		SchemaVersion: version,
+		AggregateType: aggregate,
+		Name:          name,
+		Id:            fmt.Sprintf("%v_%v_v%v", aggregate, name, version),
+	}
+}
+
+// RegisterEvent registers T under an explicit event type name.
+// Registered types take precedence over the type name convention for both
+// serialisation and deserialisation.
+func RegisterEvent[T any](name string, aggregateType AggregateType, version SchemaVersion) (EventType, error) {
+	ty := reflect.TypeFor[T]()
+	eventType := NewEventType(name, aggregateType, version)
+	return eventType, registry.register(ty, eventType)
+}
+
+func (r *eventRegistry) register(ty reflect.Type, eventType EventType) error {
+	if eventType.Name == "" || eventType.AggregateType == "" {
+		return fmt.Errorf("event type for %v requires a name and aggregate type", ty)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.byType[ty]; ok && existing != eventType {
+		return fmt.Errorf("%v is already registered as event type %v", ty, existing.Id)
+	}
+	if existing, ok := r.byId[eventType.Id]; ok && existing != ty {
+		return fmt.Errorf("event type %v is already registered to %v", eventType.Id, existing)
+	}
+	r.byType[ty] = eventType
+	r.byId[eventType.Id] = ty
+	return nil
+}
+
+func (r *eventRegistry) eventType(ty reflect.Type) (EventType, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	eventType, ok := r.byType[ty]
+	return eventType, ok
+}
+
+func (r *eventRegistry) goType(id string) (reflect.Type, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ty, ok := r.byId[id]
+	return ty, ok
+}
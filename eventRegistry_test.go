@@ -0,0 +1,109 @@
+package moments
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type OrderPlaced struct {
+	OrderId string
+}
+
+type order_line_added_v2 struct {
+	Sku string
+}
+
+type orderCancelled struct {
+	Reason string
+}
+
+func (orderCancelled) EventType() EventType {
+	return NewEventType("cancelled", "order", 1)
+}
+
+func TestRegisterEvent(t *testing.T) {
+	eventType, err := RegisterEvent[OrderPlaced]("placed", "order", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, EventType{
+		SchemaVersion: 1, AggregateType: "order", Name: "placed", Id: "order_placed_v1",
+	}, eventType)
+
+	resolved, err := GetEventType(OrderPlaced{})
+	assert.NoError(t, err)
+	assert.Equal(t, eventType, *resolved)
+}
+
+func TestRegisterEventOverridesConvention(t *testing.T) {
+	eventType, err := RegisterEvent[order_line_added_v2]("line_added", "order", 2)
+	assert.NoError(t, err)
+
+	resolved, err := GetEventType(order_line_added_v2{})
+	assert.NoError(t, err)
+	assert.Equal(t, eventType, *resolved)
+}
+
+func TestRegisterEventTwiceWithSameTypeIsAllowed(t *testing.T) {
+	_, err := RegisterEvent[OrderPlaced]("placed", "order", 1)
+	assert.NoError(t, err)
+	_, err = RegisterEvent[OrderPlaced]("placed", "order", 1)
+	assert.NoError(t, err)
+}
+
+func TestRegisterEventConflicts(t *testing.T) {
+	_, err := RegisterEvent[OrderPlaced]("placed", "order", 1)
+	assert.NoError(t, err)
+
+	_, err = RegisterEvent[OrderPlaced]("submitted", "order", 1)
+	assert.Error(t, err)
+
+	_, err = RegisterEvent[orderCancelled]("placed", "order", 1)
+	assert.Error(t, err)
+}
+
+func TestEventTyper(t *testing.T) {
+	resolved, err := GetEventType(orderCancelled{})
+	assert.NoError(t, err)
+	assert.Equal(t, "order_cancelled_v1", resolved.Id)
+}
+
+func TestGetEventTypeConventionFallback(t *testing.T) {
+	_, err := GetEventType(struct{}{})
+	assert.Error(t, err)
+
+	resolved, err := GetEventType(calculator_added_v1{})
+	assert.NoError(t, err)
+	assert.Equal(t, "calculator_added_v1", resolved.Id)
+}
+
+func TestNewEventTypeMatchesConvention(t *testing.T) {
+	convention, err := getEventTypeFromName("OrderItem_PartiallyFulfilled_V1")
+	require.NoError(t, err)
+	assert.Equal(t, *convention, NewEventType("PartiallyFulfilled", "OrderItem", 1))
+	assert.Equal(t, *convention, NewEventType("partially_fulfilled", "order_item", 1))
+
+	resolved, err := GetEventType(calculator_added_v1{})
+	require.NoError(t, err)
+	assert.Equal(t, *resolved, NewEventType("added", calculatorType, 1))
+}
+
+func TestDeserialiseRegisteredEvent(t *testing.T) {
+	eventType, err := RegisterEvent[OrderPlaced]("placed", "order", 1)
+	assert.NoError(t, err)
+
+	deserialiser := NewEventDeserialiser()
+	data, err := deserialiser.Deserialise(eventType, []byte(`{"OrderId":"o1"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, OrderPlaced{OrderId: "o1"}, data)
+}
+
+func TestAddJsonEventDeserialiserForEventTyper(t *testing.T) {
+	deserialiser := NewEventDeserialiser()
+	err := AddJsonEventDeserialiser[orderCancelled](deserialiser)
+	assert.NoError(t, err)
+
+	data, err := deserialiser.Deserialise(orderCancelled{}.EventType(), []byte(`{"Reason":"late"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, orderCancelled{Reason: "late"}, data)
+}
@@ -0,0 +1,128 @@
+package moments
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// EventSerialiser serialises event data. The ContentType is recorded on each
+// PersistedEvent so events written in different formats can be read back.
+type EventSerialiser struct {
+	ContentType string
+	Marshal     func(v any) ([]byte, error)
+	Unmarshal   func(data []byte, v any) error
+}
+
+const (
+	JsonContentType = "application/json"
+	GobContentType  = "application/x-gob"
+)
+
+var JsonEventSerialiser EventSerialiser = EventSerialiser{
+	ContentType: JsonContentType,
+	Marshal: func(v any) ([]byte, error) {
+		return json.Marshal(v)
+	},
+	Unmarshal: func(data []byte, v any) error {
+		return json.Unmarshal(data, v)
+	},
+}
+
+var GobEventSerialiser EventSerialiser = EventSerialiser{
+	ContentType: GobContentType,
+	Marshal:     gobMarshal,
+	Unmarshal:   gobUnmarshal,
+}
+
+func gobMarshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gobUnmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// eventSerialiser returns the serialiser events of the given type are written with.
+func (c *Config) eventSerialiser(eventType EventType) *EventSerialiser {
+	if serialiser, ok := c.EventSerialisers[eventType]; ok {
+		return serialiser
+	}
+	if c.DefaultEventSerialiser != nil {
+		return c.DefaultEventSerialiser
+	}
+	return &JsonEventSerialiser
+}
+
+// eventSerialiserFor returns the serialiser for a content type. Events persisted
+// without a content type were written as json.
+func (c *Config) eventSerialiserFor(contentType string) (*EventSerialiser, error) {
+	switch contentType {
+	case "", JsonContentType:
+		return &JsonEventSerialiser, nil
+	case GobContentType:
+		return &GobEventSerialiser, nil
+	}
+	if c.DefaultEventSerialiser != nil && c.DefaultEventSerialiser.ContentType == contentType {
+		return c.DefaultEventSerialiser, nil
+	}
+	// Config.validate rejects serialisers that share a content type, so at most one matches
+	for _, serialiser := range c.EventSerialisers {
+		if serialiser.ContentType == contentType {
+			return serialiser, nil
+		}
+	}
+	return nil, fmt.Errorf("no event serialiser for content type %v", contentType)
+}
+
+// marshalEvent serialises the event's data with the serialiser configured for its type,
+// recording the serialiser's content type on the event. Events that already have a
+// content type, such as imported events, keep it.
+func (c *Config) marshalEvent(event *PersistedEvent) ([]byte, error) {
+	serialiser := c.eventSerialiser(event.EventType)
+	if event.ContentType != "" {
+		var err error
+		if serialiser, err = c.eventSerialiserFor(event.ContentType); err != nil {
+			return nil, err
+		}
+	}
+	data, err := serialiser.Marshal(event.Data)
+	if err != nil {
+		return nil, err
+	}
+	event.ContentType = serialiser.ContentType
+	return data, nil
+}
+
+// unmarshalEvent deserialises event data written with the given content type.
+func (c *Config) unmarshalEvent(eventType EventType, contentType string, data []byte) (any, error) {
+	serialiser, err := c.eventSerialiserFor(contentType)
+	if err != nil {
+		return nil, err
+	}
+	return c.EventDeserialiser.DeserialiseWith(serialiser, eventType, data)
+}
+
+// DeserialiseWith deserialises event data written by the given serialiser. Json data is
+// passed to the deserialiser registered for the event type, other formats are decoded
+// into the Go type added to the deserialiser or registered with RegisterEvent.
+func (c *EventDeserialiser) DeserialiseWith(serialiser *EventSerialiser, eventType EventType, data []byte) (any, error) {
+	if serialiser.ContentType == JsonContentType {
+		return c.Deserialise(eventType, data)
+	}
+	ty, ok := c.goType(eventType)
+	if !ok {
+		return nil, fmt.Errorf("no Go type registered for event type %v", eventType)
+	}
+	val := reflect.New(ty)
+	if err := serialiser.Unmarshal(data, val.Interface()); err != nil {
+		return nil, err
+	}
+	return val.Elem().Interface(), nil
+}
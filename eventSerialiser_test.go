@@ -0,0 +1,135 @@
+package moments
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createSerialiserSession(t *testing.T, config Config) (*Session, *MemoryStore) {
+	config.Aggregates = map[AggregateType]AggregateConfig{
+		calculatorType: {StoreStrategy: alwaysSnapshot},
+	}
+	config.EventDeserialiser = createEventDeserialiser()
+	session := createSession(t, config)
+	return session, session.Store.(*MemoryStore)
+}
+
+func mustEventType(t *testing.T, value any) EventType {
+	eventType, err := GetEventType(value)
+	require.NoError(t, err)
+	return *eventType
+}
+
+func TestEventSerialiserSelectedPerEventType(t *testing.T) {
+	session, store := createSerialiserSession(t, Config{
+		EventSerialisers: map[EventType]*EventSerialiser{
+			mustEventType(t, calculator_added_v1{}): &GobEventSerialiser,
+		},
+	})
+	calc := newCalculator("c1")
+	calc.update(5)
+	calc.add(2)
+	require.NoError(t, session.Save(calc))
+
+	events, err := session.LoadStream(calc.StreamId())
+	require.NoError(t, err)
+	assert.Equal(t, []string{JsonContentType, GobContentType},
+		mapSlice(events, func(e PersistedEvent) string { return e.ContentType }))
+	assert.Equal(t, []any{calculator_updated_v1{Value: 5}, calculator_added_v1{Value: 2}},
+		mapSlice(events, func(e PersistedEvent) any { return e.Data }))
+	assert.False(t, json.Valid(store.state.eventData[2]))
+
+	loaded := newCalculator("c1")
+	require.NoError(t, session.LoadAggregate(loaded))
+	assert.Equal(t, 7, loaded.State().Value)
+}
+
+func TestDefaultEventSerialiserAndGobSnapshots(t *testing.T) {
+	session, _ := createSerialiserSession(t, Config{
+		DefaultEventSerialiser: &GobEventSerialiser,
+		SnapshotSerialiser:     &GobSnapshotSerialiser,
+	})
+	calc := newCalculator("c1")
+	calc.update(3)
+	require.NoError(t, session.Save(calc))
+
+	events, err := session.LoadStream(calc.StreamId())
+	require.NoError(t, err)
+	assert.Equal(t, GobContentType, events[0].ContentType)
+	loaded := newCalculator("c1")
+	require.NoError(t, session.LoadAggregate(loaded))
+	assert.Equal(t, 3, loaded.State().Value)
+}
+
+func TestEventsWithoutContentTypeAreReadAsJson(t *testing.T) {
+	session, store := createSerialiserSession(t, Config{})
+	calc := newCalculator("c1")
+	calc.update(4)
+	require.NoError(t, session.Save(calc))
+	store.state.events[0].ContentType = ""
+	store.config.DefaultEventSerialiser = &GobEventSerialiser
+
+	events, err := session.LoadEvents(LoadEventArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, calculator_updated_v1{Value: 4}, events[0].Data)
+}
+
+func TestUnknownContentTypeFailsToLoad(t *testing.T) {
+	session, store := createSerialiserSession(t, Config{})
+	calc := newCalculator("c1")
+	calc.update(4)
+	require.NoError(t, session.Save(calc))
+	store.state.events[0].ContentType = "application/cbor"
+
+	_, err := session.LoadEvents(LoadEventArgs{})
+	assert.ErrorContains(t, err, "application/cbor")
+}
+
+func TestConfigRequiresGoTypeForNonJsonSerialisers(t *testing.T) {
+	config := Config{
+		EventSerialisers: map[EventType]*EventSerialiser{
+			NewEventType("unknown", "Nothing", 1): &GobEventSerialiser,
+		},
+	}
+	assert.Error(t, config.validate())
+}
+
+func TestNonJsonEventsDecodeWithTheConfigsDeserialiser(t *testing.T) {
+	eventType := mustEventType(t, calculator_added_v1{})
+	// Another deserialiser knowing the Go type must not make it decodable by this one
+	createEventDeserialiser()
+	empty := NewEventDeserialiser()
+	data, err := gobMarshal(calculator_added_v1{Value: 2})
+	require.NoError(t, err)
+	_, err = empty.DeserialiseWith(&GobEventSerialiser, eventType, data)
+	assert.ErrorContains(t, err, "no Go type")
+
+	config := Config{
+		EventDeserialiser: &empty,
+		EventSerialisers:  map[EventType]*EventSerialiser{eventType: &GobEventSerialiser},
+	}
+	assert.ErrorContains(t, config.validate(), "no Go type")
+}
+
+func TestConfigRejectsSerialisersSharingContentType(t *testing.T) {
+	cbor := &EventSerialiser{ContentType: "application/cbor", Marshal: gobMarshal, Unmarshal: gobUnmarshal}
+	otherCbor := &EventSerialiser{ContentType: "application/cbor", Marshal: gobMarshal, Unmarshal: gobUnmarshal}
+	config := Config{
+		EventDeserialiser: createEventDeserialiser(),
+		EventSerialisers: map[EventType]*EventSerialiser{
+			mustEventType(t, calculator_added_v1{}):   cbor,
+			mustEventType(t, calculator_updated_v1{}): cbor,
+		},
+	}
+	assert.NoError(t, config.validate())
+
+	config.DefaultEventSerialiser = otherCbor
+	assert.ErrorContains(t, config.validate(), "more than one event serialiser has content type application/cbor")
+
+	copied := JsonEventSerialiser
+	config.DefaultEventSerialiser = &copied
+	assert.ErrorContains(t, config.validate(), "content type application/json")
+}
@@ -13,7 +13,7 @@ func TestGetEventTypeName(t *testing.T) {
 	assert.Equal(t, SchemaVersion(1), evtType.SchemaVersion)
 	assert.Equal(t, "order_item", evtType.AggregateType)
 	assert.Equal(t, "partially_fulfilled", evtType.Name)
-	assert.Equal(t, "OrderItem_PartiallyFulfilled_V1", evtType.Id)
+	assert.Equal(t, "order_item_partially_fulfilled_v1", evtType.Id)
 }
 
 func TestNewEventWithJustData(t *testing.T) {
@@ -25,9 +25,10 @@ func TestNewEventWithJustData(t *testing.T) {
 }
 
 func TestToPersistedEvent(t *testing.T) {
-	evt := NewEvent(calculator_added_v1{value: 8}, &ApplyArgs{
+	timestamp := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	evt := NewEvent(calculator_added_v1{Value: 8}, &ApplyArgs{
 		EventId:   "1",
-		Timestamp: time.Now(),
+		Timestamp: timestamp,
 	})
 
 	seq := Sequence(1)
@@ -45,4 +46,5 @@ func TestToPersistedEvent(t *testing.T) {
 	assert.Equal(t, seq, pe.Sequence)
 	assert.Equal(t, streamId, pe.StreamId)
 	assert.Equal(t, globalSeq, pe.GlobalSequence)
+	assert.Equal(t, timestamp, pe.Timestamp)
 }
@@ -0,0 +1,320 @@
+package moments
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrReadOnly is returned when writing to a follower that has not been promoted.
+var ErrReadOnly = errors.New("store is read only")
+
+// ReplicationFeed exposes a primary's events in GlobalSequence order for followers to tail.
+type ReplicationFeed interface {
+	Tenants() ([]TenantId, error)
+	// ReadFeed returns up to count of the tenant's events after the given GlobalSequence.
+	// A count of 0 returns every remaining event.
+	ReadFeed(tenant TenantId, after Sequence, count uint) ([]PersistedEvent, error)
+	// HeadSequence returns the GlobalSequence of the tenant's latest event.
+	HeadSequence(tenant TenantId) (Sequence, error)
+}
+
+type FollowerOptions struct {
+	// PollInterval is how often the primary is polled for new events. Defaults to 100ms.
+	PollInterval time.Duration
+	// BatchSize is the maximum number of events read from the feed at once. Defaults to 500.
+	BatchSize uint
+	Clock     Clock
+	Logger    *slog.Logger
+}
+
+func (o FollowerOptions) withDefaults() FollowerOptions {
+	if o.PollInterval == 0 {
+		o.PollInterval = 100 * time.Millisecond
+	}
+	if o.BatchSize == 0 {
+		o.BatchSize = 500
+	}
+	if o.Clock == nil {
+		o.Clock = SystemClock
+	}
+	if o.Logger == nil {
+		o.Logger = slog.Default()
+	}
+	return o
+}
+
+// ReplicationLag reports how far a follower's tenant is behind the primary.
+type ReplicationLag struct {
+	// Sequence is the GlobalSequence of the latest event replicated to the follower
+	Sequence Sequence
+	// PrimarySequence is the GlobalSequence of the primary's latest event
+	PrimarySequence Sequence
+	// Events is the number of events not yet replicated
+	Events uint64
+	// Time is the age of the oldest event not yet replicated, or 0 when caught up
+	Time time.Duration
+}
+
+// FollowerStoreProvider asynchronously replicates a primary's tenants into a local provider
+// by tailing its ReplicationFeed. Until promoted it serves reads from the local provider and
+// rejects writes with ErrReadOnly. Tenant deletions on the primary are not replicated.
+//
+// The follower is itself a ReplicationFeed, so followers can be chained and a promoted
+// follower can serve as the primary of others.
+type FollowerStoreProvider struct {
+	primary ReplicationFeed
+	local   StoreProvider
+	feed    ReplicationFeed
+	options FollowerOptions
+
+	// syncMu serialises replication passes
+	syncMu   sync.Mutex
+	mu       sync.RWMutex
+	promoted bool
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewFollowerStoreProvider creates a follower of the primary. The local provider must
+// implement ReplicationFeed and its stores must implement EventImporter.
+func NewFollowerStoreProvider(
+	primary ReplicationFeed, local StoreProvider, options FollowerOptions,
+) (*FollowerStoreProvider, error) {
+	feed, ok := local.(ReplicationFeed)
+	if !ok {
+		return nil, fmt.Errorf("local store provider %T does not implement ReplicationFeed", local)
+	}
+	return &FollowerStoreProvider{
+		primary: primary,
+		local:   local,
+		feed:    feed,
+		options: options.withDefaults(),
+	}, nil
+}
+
+// Start tails the primary in the background until the follower is promoted or closed.
+func (p *FollowerStoreProvider) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopCh != nil || p.promoted {
+		return
+	}
+	p.stopCh = make(chan struct{})
+	p.wg.Add(1)
+	go p.run(p.stopCh)
+}
+
+func (p *FollowerStoreProvider) run(stopCh chan struct{}) {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.options.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if err := p.Sync(); err != nil {
+				p.options.Logger.Error("replication failed", "err", err)
+			}
+		}
+	}
+}
+
+func (p *FollowerStoreProvider) stop() {
+	p.mu.Lock()
+	stopCh := p.stopCh
+	p.stopCh = nil
+	p.mu.Unlock()
+	if stopCh != nil {
+		close(stopCh)
+		p.wg.Wait()
+	}
+}
+
+// Sync replicates every event the primary has stored since the last pass.
+func (p *FollowerStoreProvider) Sync() error {
+	p.syncMu.Lock()
+	defer p.syncMu.Unlock()
+	if p.IsPromoted() {
+		return nil
+	}
+	tenants, err := p.primary.Tenants()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, tenant := range tenants {
+		if err := p.syncTenant(tenant); err != nil {
+			errs = append(errs, fmt.Errorf("tenant %v: %w", tenant, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *FollowerStoreProvider) syncTenant(tenant TenantId) error {
+	exists, err := p.local.TenantExists(tenant)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := p.local.NewTenant(tenant); err != nil {
+			return err
+		}
+	}
+	store, err := p.local.NewStore(tenant)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	importer, ok := store.(EventImporter)
+	if !ok {
+		return fmt.Errorf("local store %T does not implement EventImporter", store)
+	}
+	sequence, err := p.feed.HeadSequence(tenant)
+	if err != nil {
+		return err
+	}
+	for {
+		events, err := p.primary.ReadFeed(tenant, sequence, p.options.BatchSize)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		if err := importer.ImportEvents(events); err != nil {
+			return err
+		}
+		sequence = events[len(events)-1].GlobalSequence
+	}
+}
+
+// Lag reports how far the tenant's local copy is behind the primary.
+func (p *FollowerStoreProvider) Lag(tenant TenantId) (ReplicationLag, error) {
+	primarySequence, err := p.primary.HeadSequence(tenant)
+	if err != nil {
+		return ReplicationLag{}, err
+	}
+	lag := ReplicationLag{PrimarySequence: primarySequence}
+	exists, err := p.local.TenantExists(tenant)
+	if err != nil {
+		return ReplicationLag{}, err
+	}
+	if exists {
+		if lag.Sequence, err = p.feed.HeadSequence(tenant); err != nil {
+			return ReplicationLag{}, err
+		}
+	}
+	if lag.Sequence >= primarySequence {
+		return lag, nil
+	}
+	lag.Events = uint64(primarySequence - lag.Sequence)
+	next, err := p.primary.ReadFeed(tenant, lag.Sequence, 1)
+	if err != nil {
+		return ReplicationLag{}, err
+	}
+	if len(next) > 0 {
+		lag.Time = max(0, p.options.Clock.Now().Sub(next[0].Timestamp))
+	}
+	return lag, nil
+}
+
+// Promote stops replication and makes the follower writable, for use when the primary is lost.
+// Call Sync first to replicate any events the primary can still serve.
+func (p *FollowerStoreProvider) Promote() {
+	p.stop()
+	p.syncMu.Lock()
+	defer p.syncMu.Unlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.promoted = true
+}
+
+func (p *FollowerStoreProvider) IsPromoted() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.promoted
+}
+
+func (p *FollowerStoreProvider) NewTenant(id TenantId) error {
+	if !p.IsPromoted() {
+		return ErrReadOnly
+	}
+	return p.local.NewTenant(id)
+}
+
+func (p *FollowerStoreProvider) DeleteTenant(id TenantId) error {
+	if !p.IsPromoted() {
+		return ErrReadOnly
+	}
+	return p.local.DeleteTenant(id)
+}
+
+func (p *FollowerStoreProvider) TenantExists(id TenantId) (bool, error) {
+	return p.local.TenantExists(id)
+}
+
+func (p *FollowerStoreProvider) NewStore(tenant TenantId) (Store, error) {
+	store, err := p.local.NewStore(tenant)
+	if err != nil {
+		return nil, err
+	}
+	return &followerStore{store: store, provider: p}, nil
+}
+
+func (p *FollowerStoreProvider) Tenants() ([]TenantId, error) {
+	return p.feed.Tenants()
+}
+
+func (p *FollowerStoreProvider) ReadFeed(tenant TenantId, after Sequence, count uint) ([]PersistedEvent, error) {
+	return p.feed.ReadFeed(tenant, after, count)
+}
+
+func (p *FollowerStoreProvider) HeadSequence(tenant TenantId) (Sequence, error) {
+	return p.feed.HeadSequence(tenant)
+}
+
+// Close stops replication and closes the local provider.
+func (p *FollowerStoreProvider) Close() {
+	p.stop()
+	p.local.Close()
+}
+
+// followerStore serves reads from the local store and rejects writes until promoted.
+type followerStore struct {
+	store    Store
+	provider *FollowerStoreProvider
+}
+
+func (s *followerStore) SaveEvents(args SaveEventArgs) error {
+	if !s.provider.IsPromoted() {
+		return ErrReadOnly
+	}
+	return s.store.SaveEvents(args)
+}
+
+func (s *followerStore) LoadEvents(options LoadEventArgs) ([]PersistedEvent, error) {
+	return s.store.LoadEvents(options)
+}
+
+func (s *followerStore) SaveSnapshot(snapshot *Snapshot) error {
+	if !s.provider.IsPromoted() {
+		return ErrReadOnly
+	}
+	return s.store.SaveSnapshot(snapshot)
+}
+
+func (s *followerStore) LoadSnapshot(id SnapshotId) (*Snapshot, error) {
+	return s.store.LoadSnapshot(id)
+}
+
+func (s *followerStore) DeleteSnapshot(id SnapshotId) error {
+	if !s.provider.IsPromoted() {
+		return ErrReadOnly
+	}
+	return s.store.DeleteSnapshot(id)
+}
+
+func (s *followerStore) Close() {
+	s.store.Close()
+}
@@ -0,0 +1,139 @@
+package moments
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type replicationFixture struct {
+	config   *Config
+	primary  *MemoryStoreProvider
+	follower *FollowerStoreProvider
+	clock    *time.Time
+}
+
+func newReplicationFixture(t *testing.T) *replicationFixture {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := &replicationFixture{clock: &now}
+	f.config = &Config{
+		Aggregates: map[AggregateType]AggregateConfig{
+			"Calculator": {StoreStrategy: eventSourced},
+		},
+		EventDeserialiser: createEventDeserialiser(),
+		Clock:             ClockFunc(func() time.Time { return *f.clock }),
+	}
+	f.primary = NewMemoryStoreProvider(f.config)
+	require.NoError(t, f.primary.NewTenant("default"))
+	follower, err := NewFollowerStoreProvider(f.primary, NewMemoryStoreProvider(f.config),
+		FollowerOptions{PollInterval: 10 * time.Millisecond, BatchSize: 2, Clock: f.config.Clock})
+	require.NoError(t, err)
+	f.follower = follower
+	t.Cleanup(follower.Close)
+	return f
+}
+
+func (f *replicationFixture) session(t *testing.T, provider StoreProvider) *Session {
+	sessionProvider, err := NewSessionProvider(provider, *f.config)
+	require.NoError(t, err)
+	session, err := sessionProvider.NewSession("default")
+	require.NoError(t, err)
+	return session
+}
+
+func (f *replicationFixture) add(t *testing.T, provider StoreProvider, id string, values ...int) {
+	session := f.session(t, provider)
+	calc := newCalculator(id)
+	require.NoError(t, session.LoadAggregate(calc))
+	for _, value := range values {
+		calc.add(value)
+	}
+	require.NoError(t, session.Save(calc))
+}
+
+func TestFollowerReplicatesPrimaryEvents(t *testing.T) {
+	f := newReplicationFixture(t)
+	f.add(t, f.primary, "c1", 1, 2, 3)
+	f.add(t, f.primary, "c2", 10)
+
+	require.NoError(t, f.follower.Sync())
+
+	primaryEvents, err := f.session(t, f.primary).LoadEvents(LoadEventArgs{})
+	require.NoError(t, err)
+	followerEvents, err := f.session(t, f.follower).LoadEvents(LoadEventArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, primaryEvents, followerEvents)
+
+	calc := newCalculator("c1")
+	require.NoError(t, f.session(t, f.follower).LoadAggregate(calc))
+	assert.Equal(t, 6, calc.State().Value)
+}
+
+func TestFollowerIsReadOnlyUntilPromoted(t *testing.T) {
+	f := newReplicationFixture(t)
+	f.add(t, f.primary, "c1", 1)
+	require.NoError(t, f.follower.Sync())
+
+	session := f.session(t, f.follower)
+	calc := newCalculator("c1")
+	require.NoError(t, session.LoadAggregate(calc))
+	calc.add(1)
+	assert.ErrorIs(t, session.Save(calc), ErrReadOnly)
+	assert.ErrorIs(t, f.follower.NewTenant("other"), ErrReadOnly)
+
+	f.follower.Promote()
+	assert.True(t, f.follower.IsPromoted())
+	require.NoError(t, session.Save(calc))
+
+	// A promoted follower no longer tails the old primary
+	f.add(t, f.primary, "c2", 1)
+	require.NoError(t, f.follower.Sync())
+	events, err := session.LoadEvents(LoadEventArgs{})
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+}
+
+func TestFollowerReportsLag(t *testing.T) {
+	f := newReplicationFixture(t)
+	f.add(t, f.primary, "c1", 1)
+	require.NoError(t, f.follower.Sync())
+	written := *f.clock
+	f.add(t, f.primary, "c1", 2, 3)
+	*f.clock = written.Add(time.Minute)
+
+	lag, err := f.follower.Lag("default")
+	require.NoError(t, err)
+	assert.Equal(t, ReplicationLag{Sequence: 1, PrimarySequence: 3, Events: 2, Time: time.Minute}, lag)
+
+	require.NoError(t, f.follower.Sync())
+	lag, err = f.follower.Lag("default")
+	require.NoError(t, err)
+	assert.Equal(t, ReplicationLag{Sequence: 3, PrimarySequence: 3}, lag)
+}
+
+func TestFollowerTailsPrimaryInBackground(t *testing.T) {
+	f := newReplicationFixture(t)
+	f.follower.Start()
+	f.add(t, f.primary, "c1", 1, 2)
+
+	assert.Eventually(t, func() bool {
+		lag, err := f.follower.Lag("default")
+		return err == nil && lag.Sequence == 2 && lag.Events == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestImportEventsRejectsGaps(t *testing.T) {
+	f := newReplicationFixture(t)
+	f.add(t, f.primary, "c1", 1, 2)
+	events, err := f.primary.ReadFeed("default", 1, 0)
+	require.NoError(t, err)
+
+	local := NewMemoryStoreProvider(f.config)
+	require.NoError(t, local.NewTenant("default"))
+	store, err := local.NewStore("default")
+	require.NoError(t, err)
+	err = store.(EventImporter).ImportEvents(events)
+	assert.ErrorIs(t, err, ErrConcurrencyConflict)
+}
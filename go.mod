@@ -3,12 +3,12 @@ module github.com/danyo1399/moments
 go 1.24.2
 
 require (
+	github.com/danyo1399/gotils v0.0.3
 	github.com/google/uuid v1.6.0
 	github.com/stretchr/testify v1.10.0
 )
 
 require (
-	github.com/danyo1399/gotils v0.0.3 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
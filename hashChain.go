@@ -0,0 +1,101 @@
+package moments
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// BrokenLink describes the first event at which a hash chain fails to verify.
+type BrokenLink struct {
+	StreamId       StreamId
+	Version        Version
+	GlobalSequence Sequence
+	Reason         string
+}
+
+func (b BrokenLink) String() string {
+	return fmt.Sprintf("%v version %v at sequence %v: %v", b.StreamId, b.Version, b.GlobalSequence, b.Reason)
+}
+
+// ChainVerifier is implemented by stores that chain the hashes of the events they save.
+// Each event's Hash covers its serialised data, its envelope and the hashes of the events
+// before it in its stream and in the tenant's log, so altering, removing or reordering an
+// event breaks the chain from that event on.
+type ChainVerifier interface {
+	// VerifyStream walks the stream's events and returns the first broken link, or nil.
+	VerifyStream(streamId StreamId) (*BrokenLink, error)
+	// VerifyLog walks every event of the tenant and returns the first broken link, or nil.
+	VerifyLog() (*BrokenLink, error)
+}
+
+// eventHash returns the hex encoded SHA-256 hash of the event chained to its previous hashes.
+// The payload is the event's data as serialised by its EventSerialiser.
+func eventHash(event PersistedEvent, payload []byte) (string, error) {
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return "", err
+	}
+	payloadHash := sha256.Sum256(payload)
+	h := sha256.New()
+	for _, field := range []string{
+		event.PreviousHash,
+		event.PreviousGlobalHash,
+		string(event.EventId),
+		event.StreamId.String(),
+		event.EventType.Id,
+		event.ContentType,
+		event.Timestamp.UTC().Format(time.RFC3339Nano),
+		string(event.CorrelationId),
+		string(event.CausationId),
+		string(metadata),
+		string(payloadHash[:]),
+	} {
+		// Length prefixes keep adjacent fields from being shifted into each other
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(len(field))))
+		h.Write([]byte(field))
+	}
+	h.Write(binary.BigEndian.AppendUint64(nil, uint64(event.Version)))
+	h.Write(binary.BigEndian.AppendUint64(nil, uint64(event.GlobalSequence)))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyChain checks the hashes of events in order. When global is set the events are the
+// tenant's whole log and are linked by PreviousGlobalHash, otherwise they are a single stream
+// linked by PreviousHash.
+func verifyChain(events []PersistedEvent, payload func(PersistedEvent) ([]byte, error), global bool) (*BrokenLink, error) {
+	previous := ""
+	for _, evt := range events {
+		broken := func(reason string, args ...any) *BrokenLink {
+			return &BrokenLink{
+				StreamId:       evt.StreamId,
+				Version:        evt.Version,
+				GlobalSequence: evt.GlobalSequence,
+				Reason:         fmt.Sprintf(reason, args...),
+			}
+		}
+		link := evt.PreviousHash
+		if global {
+			link = evt.PreviousGlobalHash
+		}
+		if link != previous {
+			return broken("previous hash %q does not match %q", link, previous), nil
+		}
+		data, err := payload(evt)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := eventHash(evt, data)
+		if err != nil {
+			return nil, err
+		}
+		if hash != evt.Hash {
+			return broken("hash %q does not match contents %q", evt.Hash, hash), nil
+		}
+		previous = evt.Hash
+	}
+	return nil, nil
+}
@@ -0,0 +1,139 @@
+package moments
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func saveCalculators(t *testing.T, session *Session) {
+	for _, id := range []string{"c1", "c2", "c1"} {
+		calc := newCalculator(id)
+		require.NoError(t, session.LoadAggregate(calc))
+		calc.add(1)
+		calc.add(2)
+		require.NoError(t, session.Save(calc))
+	}
+}
+
+func TestHashChainLinksStreamAndLog(t *testing.T) {
+	session, store := createEncryptedSession(t, NewEnvelopeEncryption(NewMemoryKeyring("k1", testKey(1))))
+	saveCalculators(t, session)
+
+	events, err := session.LoadEvents(LoadEventArgs{})
+	require.NoError(t, err)
+	for i, evt := range events {
+		assert.NotEmpty(t, evt.Hash)
+		if i > 0 {
+			assert.Equal(t, events[i-1].Hash, evt.PreviousGlobalHash)
+		}
+	}
+	c1, err := session.LoadStream(newCalculator("c1").StreamId())
+	require.NoError(t, err)
+	assert.Equal(t, "", c1[0].PreviousHash)
+	assert.Equal(t, c1[1].Hash, c1[2].PreviousHash)
+
+	broken, err := store.VerifyLog()
+	require.NoError(t, err)
+	assert.Nil(t, broken)
+	broken, err = store.VerifyStream(newCalculator("c2").StreamId())
+	require.NoError(t, err)
+	assert.Nil(t, broken)
+}
+
+func TestHashChainDetectsAlteredData(t *testing.T) {
+	session, store := createEncryptedSession(t)
+	saveCalculators(t, session)
+	store.state.eventData[4] = []byte(`{"Value":100}`)
+
+	broken, err := store.VerifyLog()
+	require.NoError(t, err)
+	require.NotNil(t, broken)
+	assert.Equal(t, Sequence(4), broken.GlobalSequence)
+
+	broken, err = store.VerifyStream(newCalculator("c2").StreamId())
+	require.NoError(t, err)
+	require.NotNil(t, broken)
+	assert.Equal(t, Version(2), broken.Version)
+
+	broken, err = store.VerifyStream(newCalculator("c1").StreamId())
+	require.NoError(t, err)
+	assert.Nil(t, broken)
+}
+
+func TestHashChainDetectsAlteredEnvelope(t *testing.T) {
+	session, store := createEncryptedSession(t)
+	saveCalculators(t, session)
+	store.state.events[1].Metadata = Metadata{"user": "mallory"}
+
+	broken, err := store.VerifyLog()
+	require.NoError(t, err)
+	require.NotNil(t, broken)
+	assert.Equal(t, Sequence(2), broken.GlobalSequence)
+}
+
+func TestHashChainDetectsRemovedEvents(t *testing.T) {
+	session, store := createEncryptedSession(t)
+	saveCalculators(t, session)
+	store.state.events = slices.Delete(store.state.events, 2, 3)
+
+	broken, err := store.VerifyLog()
+	require.NoError(t, err)
+	require.NotNil(t, broken)
+	assert.Equal(t, Sequence(4), broken.GlobalSequence)
+	assert.Contains(t, broken.Reason, "previous hash")
+}
+
+func TestHashChainSurvivesReplication(t *testing.T) {
+	f := newReplicationFixture(t)
+	f.add(t, f.primary, "c1", 1, 2)
+	f.add(t, f.primary, "c2", 3)
+	require.NoError(t, f.follower.Sync())
+
+	local, err := f.follower.local.NewStore("default")
+	require.NoError(t, err)
+	broken, err := local.(ChainVerifier).VerifyLog()
+	require.NoError(t, err)
+	assert.Nil(t, broken)
+}
+
+type calculator_tagged_v1 struct {
+	Tags map[string]int
+}
+
+func TestHashChainSurvivesCopyingGobEventsWithMaps(t *testing.T) {
+	deserialiser := NewEventDeserialiser()
+	require.NoError(t, AddJsonEventDeserialiser[calculator_tagged_v1](deserialiser))
+	config := &Config{EventDeserialiser: &deserialiser, DefaultEventSerialiser: &GobEventSerialiser}
+	source := NewMemoryStoreProvider(config)
+	target := NewMemoryStoreProvider(config)
+	for _, provider := range []*MemoryStoreProvider{source, target} {
+		require.NoError(t, provider.NewTenant("default"))
+	}
+
+	// Gob encodes maps in random order, so serialising the data again changes its bytes
+	tags := map[string]int{}
+	for i := range 20 {
+		tags[fmt.Sprint("tag", i)] = i
+	}
+	store, err := source.NewStore("default")
+	require.NoError(t, err)
+	require.NoError(t, store.SaveEvents(SaveEventArgs{
+		StreamId:        newCalculator("c1").StreamId(),
+		Events:          []Event{NewEvent(calculator_tagged_v1{Tags: tags}, nil)},
+		ExpectedVersion: 1,
+	}))
+
+	events, err := source.ReadFeed("default", 0, 0)
+	require.NoError(t, err)
+	copied, err := target.NewStore("default")
+	require.NoError(t, err)
+	require.NoError(t, copied.(EventImporter).ImportEvents(events))
+
+	broken, err := copied.(ChainVerifier).VerifyLog()
+	require.NoError(t, err)
+	assert.Nil(t, broken)
+}
@@ -0,0 +1,126 @@
+package moments
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	mrand "math/rand/v2"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+// IdGenerator creates ids for aggregates and events.
+type IdGenerator interface {
+	NewId() string
+}
+
+// IdGeneratorFunc adapts a function to an IdGenerator.
+type IdGeneratorFunc func() string
+
+func (f IdGeneratorFunc) NewId() string {
+	return f()
+}
+
+// UUIDv7Generator is the default IdGenerator. It returns time ordered UUID v7 ids without dashes.
+var UUIDv7Generator IdGenerator = IdGeneratorFunc(newSquentialString)
+
+const (
+	crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	base62Alphabet    = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	// ksuidEpoch is the KSUID epoch in unix seconds (2014-05-13T16:53:20Z)
+	ksuidEpoch = 1400000000
+)
+
+// NewULIDGenerator returns a generator of 26 character ULIDs: a 48 bit millisecond
+// timestamp followed by 80 random bits, Crockford base32 encoded.
+// A nil clock uses SystemClock.
+func NewULIDGenerator(clock Clock) IdGenerator {
+	if clock == nil {
+		clock = SystemClock
+	}
+	return IdGeneratorFunc(func() string {
+		var b [16]byte
+		ms := uint64(clock.Now().UnixMilli())
+		binary.BigEndian.PutUint16(b[0:2], uint16(ms>>32))
+		binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+		randomBytes(b[6:])
+		return encodeBase(b[:], crockfordAlphabet, 26)
+	})
+}
+
+// NewKSUIDGenerator returns a generator of 27 character KSUIDs: a 32 bit second
+// timestamp followed by 128 random bits, base62 encoded.
+// A nil clock uses SystemClock.
+func NewKSUIDGenerator(clock Clock) IdGenerator {
+	if clock == nil {
+		clock = SystemClock
+	}
+	return IdGeneratorFunc(func() string {
+		var b [20]byte
+		binary.BigEndian.PutUint32(b[0:4], uint32(clock.Now().Unix()-ksuidEpoch))
+		randomBytes(b[4:])
+		return encodeBase(b[:], base62Alphabet, 27)
+	})
+}
+
+// NewSeededIdGenerator returns a generator that produces the same sequence of
+// 32 character hex ids for the same seed. Intended for tests.
+func NewSeededIdGenerator(seed uint64) IdGenerator {
+	var mu sync.Mutex
+	rnd := mrand.New(mrand.NewPCG(seed, seed))
+	return IdGeneratorFunc(func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		var b [16]byte
+		binary.BigEndian.PutUint64(b[0:8], rnd.Uint64())
+		binary.BigEndian.PutUint64(b[8:], rnd.Uint64())
+		return hex.EncodeToString(b[:])
+	})
+}
+
+// NewNameBasedIdGenerator returns a generator of UUID v5 ids derived from a name,
+// such as a command id, so retrying the same command produces the same ids.
+// The first id is NameBasedId(namespace, name), later ids suffix the name with a counter.
+// The generator counts the ids it has returned and is tied to its name, so create one per
+// command and give it to the aggregate handling it with WithIdGenerator. It is not suited
+// to Config.IdGenerator, where every aggregate and session would share its ids.
+func NewNameBasedIdGenerator(namespace uuid.UUID, name string) IdGenerator {
+	var count atomic.Uint64
+	return IdGeneratorFunc(func() string {
+		n := count.Add(1) - 1
+		if n == 0 {
+			return NameBasedId(namespace, name)
+		}
+		return NameBasedId(namespace, fmt.Sprintf("%v/%v", name, n))
+	})
+}
+
+// NameBasedId returns the UUID v5 of the name within the namespace without dashes.
+func NameBasedId(namespace uuid.UUID, name string) string {
+	return strings.ReplaceAll(uuid.NewSHA1(namespace, []byte(name)).String(), "-", "")
+}
+
+func randomBytes(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+}
+
+// encodeBase encodes b as a big endian number in the given alphabet,
+// left padded with the zero digit to length characters.
+func encodeBase(b []byte, alphabet string, length int) string {
+	n := new(big.Int).SetBytes(b)
+	base := big.NewInt(int64(len(alphabet)))
+	mod := new(big.Int)
+	out := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		n.DivMod(n, base, mod)
+		out[i] = alphabet[mod.Int64()]
+	}
+	return string(out)
+}
@@ -0,0 +1,94 @@
+package moments
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var fixedClock = ClockFunc(func() time.Time {
+	return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+})
+
+func TestULIDGenerator(t *testing.T) {
+	ids := NewULIDGenerator(fixedClock)
+	id := ids.NewId()
+	assert.Len(t, id, 26)
+	assert.NotEqual(t, id, ids.NewId())
+	// 2024-01-01T00:00:00Z is 1704067200000ms
+	assert.Equal(t, "01HK153X00", id[:10])
+}
+
+func TestKSUIDGenerator(t *testing.T) {
+	ids := NewKSUIDGenerator(fixedClock)
+	id := ids.NewId()
+	assert.Len(t, id, 27)
+	assert.NotEqual(t, id, ids.NewId())
+}
+
+func TestSeededIdGenerator(t *testing.T) {
+	a := NewSeededIdGenerator(42)
+	b := NewSeededIdGenerator(42)
+	first := a.NewId()
+	assert.Len(t, first, 32)
+	assert.Equal(t, first, b.NewId())
+	assert.Equal(t, a.NewId(), b.NewId())
+	assert.NotEqual(t, first, NewSeededIdGenerator(7).NewId())
+}
+
+func TestNameBasedIdGenerator(t *testing.T) {
+	a := NewNameBasedIdGenerator(uuid.NameSpaceURL, "command-1")
+	b := NewNameBasedIdGenerator(uuid.NameSpaceURL, "command-1")
+	first := a.NewId()
+	assert.Equal(t, NameBasedId(uuid.NameSpaceURL, "command-1"), first)
+	assert.Len(t, first, 32)
+	second := a.NewId()
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, first, b.NewId())
+	assert.Equal(t, second, b.NewId())
+}
+
+func TestAggregateUsesIdGenerator(t *testing.T) {
+	calc := newCalculatorAggregate(WithIdGenerator[calculatorState](NewSeededIdGenerator(1)))
+	calc.Apply(calculator_added_v1{Value: 1}, nil)
+
+	expected := NewSeededIdGenerator(1)
+	assert.Equal(t, expected.NewId(), calc.Id())
+	assert.Equal(t, EventId(expected.NewId()), calc.UnsavedEvents()[0].EventId)
+}
+
+func TestRegisterAggregateUsesConfigIdGenerator(t *testing.T) {
+	config := Config{IdGenerator: NewSeededIdGenerator(1)}
+	newCalc, err := RegisterAggregate(&config, calculatorType, AggregateConfig{}, initStateFunc, reducer)
+	assert.NoError(t, err)
+
+	assert.Equal(t, NewSeededIdGenerator(1).NewId(), newCalc().Id())
+	assert.Equal(t, "c1", newCalc(WithId[calculatorState]("c1")).Id())
+}
+
+func TestSessionUsesConfigIdGenerator(t *testing.T) {
+	session := createSession(t, Config{
+		Aggregates: map[AggregateType]AggregateConfig{
+			calculatorType: {StoreStrategy: eventSourced},
+		},
+		EventDeserialiser: createEventDeserialiser(),
+		IdGenerator:       NewSeededIdGenerator(1),
+	})
+	expected := NewSeededIdGenerator(1)
+
+	calc := newCalculator("c1")
+	require.NoError(t, session.LoadAggregate(calc))
+	calc.add(1)
+	assert.Equal(t, EventId(expected.NewId()), calc.UnsavedEvents()[0].EventId)
+	assert.Equal(t, EventId(expected.NewId()), session.NewEvent(calculator_added_v1{Value: 2}, nil).EventId)
+
+	// An aggregate's own generator takes precedence over the session's
+	own := &calculator{*newCalculatorAggregate(WithId[calculatorState]("c2"),
+		WithIdGenerator[calculatorState](NewSeededIdGenerator(7)))}
+	require.NoError(t, session.LoadAggregate(own))
+	own.add(1)
+	assert.Equal(t, EventId(NewSeededIdGenerator(7).NewId()), own.UnsavedEvents()[0].EventId)
+}
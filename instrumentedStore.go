@@ -0,0 +1,177 @@
+package moments
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// InstrumentationOptions configures the logging and metrics of instrumented stores.
+type InstrumentationOptions struct {
+	// Logger receives a debug record for every store call and an error record for failures.
+	// Defaults to slog.Default().
+	Logger *slog.Logger
+	// Metrics records call counts, latencies and event counts. Defaults to NoopMetrics.
+	Metrics Metrics
+	// Clock is used to measure latency. Defaults to SystemClock.
+	Clock Clock
+}
+
+func (o InstrumentationOptions) withDefaults() InstrumentationOptions {
+	if o.Logger == nil {
+		o.Logger = slog.Default()
+	}
+	if o.Metrics == nil {
+		o.Metrics = NoopMetrics
+	}
+	if o.Clock == nil {
+		o.Clock = SystemClock
+	}
+	return o
+}
+
+// InstrumentedStore decorates a Store with structured logging and metrics. It forwards
+// EventImporter, SnapshotLister and ChainVerifier to the decorated store, returning
+// errors.ErrUnsupported when the store does not implement them.
+type InstrumentedStore struct {
+	store   Store
+	tenant  TenantId
+	options InstrumentationOptions
+}
+
+func NewInstrumentedStore(store Store, tenant TenantId, options InstrumentationOptions) *InstrumentedStore {
+	return &InstrumentedStore{store: store, tenant: tenant, options: options.withDefaults()}
+}
+
+func (s *InstrumentedStore) SaveEvents(args SaveEventArgs) error {
+	start := s.options.Clock.Now()
+	err := s.store.SaveEvents(args)
+	s.record(args.Context, "save_events", start, len(args.Events), err,
+		slog.String("stream", args.StreamId.String()),
+		slog.Uint64("expected_version", uint64(args.ExpectedVersion)),
+		slog.Bool("snapshot", args.Snapshot != nil))
+	return err
+}
+
+func (s *InstrumentedStore) LoadEvents(options LoadEventArgs) ([]PersistedEvent, error) {
+	start := s.options.Clock.Now()
+	events, err := s.store.LoadEvents(options)
+	s.record(options.Context, "load_events", start, len(events), err,
+		slog.String("stream", options.StreamId.String()))
+	return events, err
+}
+
+func (s *InstrumentedStore) SaveSnapshot(snapshot *Snapshot) error {
+	start := s.options.Clock.Now()
+	err := s.store.SaveSnapshot(snapshot)
+	s.record(context.Background(), "save_snapshot", start, noEventCount, err,
+		slog.String("stream", snapshot.Id.StreamId.String()),
+		slog.Uint64("version", uint64(snapshot.Version)),
+		slog.Int("bytes", len(snapshot.State)))
+	return err
+}
+
+func (s *InstrumentedStore) LoadSnapshot(id SnapshotId) (*Snapshot, error) {
+	start := s.options.Clock.Now()
+	snapshot, err := s.store.LoadSnapshot(id)
+	s.record(context.Background(), "load_snapshot", start, noEventCount, err,
+		slog.String("stream", id.StreamId.String()),
+		slog.Bool("found", snapshot != nil))
+	return snapshot, err
+}
+
+func (s *InstrumentedStore) DeleteSnapshot(id SnapshotId) error {
+	start := s.options.Clock.Now()
+	err := s.store.DeleteSnapshot(id)
+	s.record(context.Background(), "delete_snapshot", start, noEventCount, err,
+		slog.String("stream", id.StreamId.String()))
+	return err
+}
+
+func (s *InstrumentedStore) ImportEvents(events []PersistedEvent) error {
+	importer, ok := s.store.(EventImporter)
+	if !ok {
+		return errUnsupported(s.store, "EventImporter")
+	}
+	start := s.options.Clock.Now()
+	err := importer.ImportEvents(events)
+	s.record(context.Background(), "import_events", start, len(events), err)
+	return err
+}
+
+func (s *InstrumentedStore) Snapshots() ([]Snapshot, error) {
+	lister, ok := s.store.(SnapshotLister)
+	if !ok {
+		return nil, errUnsupported(s.store, "SnapshotLister")
+	}
+	start := s.options.Clock.Now()
+	snapshots, err := lister.Snapshots()
+	s.record(context.Background(), "list_snapshots", start, noEventCount, err, slog.Int("snapshots", len(snapshots)))
+	return snapshots, err
+}
+
+func (s *InstrumentedStore) VerifyStream(streamId StreamId) (*BrokenLink, error) {
+	verifier, ok := s.store.(ChainVerifier)
+	if !ok {
+		return nil, errUnsupported(s.store, "ChainVerifier")
+	}
+	start := s.options.Clock.Now()
+	broken, err := verifier.VerifyStream(streamId)
+	s.record(context.Background(), "verify_stream", start, noEventCount, err,
+		slog.String("stream", streamId.String()), slog.Bool("broken", broken != nil))
+	return broken, err
+}
+
+func (s *InstrumentedStore) VerifyLog() (*BrokenLink, error) {
+	verifier, ok := s.store.(ChainVerifier)
+	if !ok {
+		return nil, errUnsupported(s.store, "ChainVerifier")
+	}
+	start := s.options.Clock.Now()
+	broken, err := verifier.VerifyLog()
+	s.record(context.Background(), "verify_log", start, noEventCount, err, slog.Bool("broken", broken != nil))
+	return broken, err
+}
+
+func (s *InstrumentedStore) Close() {
+	s.store.Close()
+}
+
+// noEventCount is passed to record by operations that do not read or write events.
+const noEventCount = -1
+
+// record logs the call and records its metrics. eventCount is ignored for noEventCount,
+// and only counted as stored events when the call succeeded.
+func (s *InstrumentedStore) record(
+	ctx context.Context, operation string, start time.Time, eventCount int, err error, attrs ...slog.Attr,
+) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	duration := s.options.Clock.Now().Sub(start)
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	labels := MetricLabels{"operation": operation, "tenant": string(s.tenant)}
+	s.options.Metrics.ObserveHistogram(MetricStoreOperationSeconds, duration.Seconds(), labels)
+	s.options.Metrics.IncCounter(MetricStoreOperations, 1,
+		MetricLabels{"operation": operation, "tenant": string(s.tenant), "status": status})
+
+	attrs = append(attrs,
+		slog.String("operation", operation),
+		slog.String("tenant", string(s.tenant)),
+		slog.Duration("duration", duration))
+	if eventCount != noEventCount {
+		if err == nil {
+			s.options.Metrics.IncCounter(MetricStoreEvents, float64(eventCount), labels)
+		}
+		attrs = append(attrs, slog.Int("events", eventCount))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("err", err))
+		s.options.Logger.LogAttrs(ctx, slog.LevelError, "store operation failed", attrs...)
+		return
+	}
+	s.options.Logger.LogAttrs(ctx, slog.LevelDebug, "store operation", attrs...)
+}
@@ -0,0 +1,75 @@
+package moments
+
+// InstrumentedStoreProvider decorates a StoreProvider so every store it creates
+// is an InstrumentedStore, and logs tenant changes. It forwards ReplicationFeed to the
+// decorated provider, returning errors.ErrUnsupported when the provider does not implement it.
+type InstrumentedStoreProvider struct {
+	provider StoreProvider
+	options  InstrumentationOptions
+}
+
+func NewInstrumentedStoreProvider(provider StoreProvider, options InstrumentationOptions) *InstrumentedStoreProvider {
+	return &InstrumentedStoreProvider{provider: provider, options: options.withDefaults()}
+}
+
+func (p *InstrumentedStoreProvider) NewTenant(id TenantId) error {
+	err := p.provider.NewTenant(id)
+	p.log("new_tenant", id, err)
+	return err
+}
+
+func (p *InstrumentedStoreProvider) DeleteTenant(id TenantId) error {
+	err := p.provider.DeleteTenant(id)
+	p.log("delete_tenant", id, err)
+	return err
+}
+
+func (p *InstrumentedStoreProvider) TenantExists(id TenantId) (bool, error) {
+	return p.provider.TenantExists(id)
+}
+
+func (p *InstrumentedStoreProvider) NewStore(tenant TenantId) (Store, error) {
+	store, err := p.provider.NewStore(tenant)
+	if err != nil {
+		p.log("new_store", tenant, err)
+		return nil, err
+	}
+	return NewInstrumentedStore(store, tenant, p.options), nil
+}
+
+func (p *InstrumentedStoreProvider) Tenants() ([]TenantId, error) {
+	feed, ok := p.provider.(ReplicationFeed)
+	if !ok {
+		return nil, errUnsupported(p.provider, "ReplicationFeed")
+	}
+	return feed.Tenants()
+}
+
+func (p *InstrumentedStoreProvider) ReadFeed(tenant TenantId, after Sequence, count uint) ([]PersistedEvent, error) {
+	feed, ok := p.provider.(ReplicationFeed)
+	if !ok {
+		return nil, errUnsupported(p.provider, "ReplicationFeed")
+	}
+	return feed.ReadFeed(tenant, after, count)
+}
+
+func (p *InstrumentedStoreProvider) HeadSequence(tenant TenantId) (Sequence, error) {
+	feed, ok := p.provider.(ReplicationFeed)
+	if !ok {
+		return 0, errUnsupported(p.provider, "ReplicationFeed")
+	}
+	return feed.HeadSequence(tenant)
+}
+
+func (p *InstrumentedStoreProvider) Close() {
+	p.provider.Close()
+}
+
+func (p *InstrumentedStoreProvider) log(operation string, tenant TenantId, err error) {
+	if err != nil {
+		p.options.Logger.Error("tenant operation failed",
+			"operation", operation, "tenant", tenant, "err", err)
+		return
+	}
+	p.options.Logger.Info("tenant operation", "operation", operation, "tenant", tenant)
+}
@@ -0,0 +1,135 @@
+package moments
+
+import (
+	"bytes"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type metricObservation struct {
+	name   string
+	value  float64
+	labels MetricLabels
+}
+
+type recordingMetrics struct {
+	mu         sync.Mutex
+	counters   []metricObservation
+	histograms []metricObservation
+}
+
+func (m *recordingMetrics) IncCounter(name string, value float64, labels MetricLabels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters = append(m.counters, metricObservation{name, value, labels})
+}
+
+func (m *recordingMetrics) ObserveHistogram(name string, value float64, labels MetricLabels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.histograms = append(m.histograms, metricObservation{name, value, labels})
+}
+
+func (m *recordingMetrics) counter(name string, labels MetricLabels) float64 {
+	total := 0.0
+	for _, c := range m.counters {
+		if c.name == name && assert.ObjectsAreEqual(labels, c.labels) {
+			total += c.value
+		}
+	}
+	return total
+}
+
+func createInstrumentedSession(t *testing.T, metrics Metrics, logs *bytes.Buffer) *Session {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	config := Config{
+		Aggregates: map[AggregateType]AggregateConfig{
+			calculatorType: {StoreStrategy: alwaysSnapshot},
+		},
+		EventDeserialiser: createEventDeserialiser(),
+	}
+	provider := NewInstrumentedStoreProvider(NewMemoryStoreProvider(&config), InstrumentationOptions{
+		Logger:  slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		Metrics: metrics,
+		Clock: ClockFunc(func() time.Time {
+			now = now.Add(time.Millisecond)
+			return now
+		}),
+	})
+	assert.NoError(t, provider.NewTenant("default"))
+	sessionProvider, err := NewSessionProvider(provider, config)
+	assert.NoError(t, err)
+	session, err := sessionProvider.NewSession("default")
+	assert.NoError(t, err)
+	return session
+}
+
+func TestInstrumentedStoreRecordsMetrics(t *testing.T) {
+	metrics := &recordingMetrics{}
+	session := createInstrumentedSession(t, metrics, &bytes.Buffer{})
+	defer session.Close()
+
+	calc := newCalculator("")
+	calc.update(5)
+	calc.add(2)
+	assert.NoError(t, session.Save(calc))
+	assert.NoError(t, session.LoadAggregate(newCalculator(calc.Id())))
+
+	assert.Equal(t, 1.0, metrics.counter(MetricStoreOperations,
+		MetricLabels{"operation": "save_events", "tenant": "default", "status": "ok"}))
+	assert.Equal(t, 2.0, metrics.counter(MetricStoreEvents,
+		MetricLabels{"operation": "save_events", "tenant": "default"}))
+	assert.Equal(t, 1.0, metrics.counter(MetricStoreOperations,
+		MetricLabels{"operation": "load_snapshot", "tenant": "default", "status": "ok"}))
+	assert.Equal(t, 1.0, metrics.counter(MetricStoreOperations,
+		MetricLabels{"operation": "load_events", "tenant": "default", "status": "ok"}))
+	for _, h := range metrics.histograms {
+		assert.Equal(t, MetricStoreOperationSeconds, h.name)
+		assert.Equal(t, 0.001, h.value)
+	}
+}
+
+func TestInstrumentedStoreLogsCalls(t *testing.T) {
+	metrics := &recordingMetrics{}
+	logs := &bytes.Buffer{}
+	session := createInstrumentedSession(t, metrics, logs)
+	defer session.Close()
+
+	calc := newCalculator("c1")
+	calc.add(2)
+	assert.NoError(t, session.Save(calc))
+	stale := newCalculator("c1")
+	stale.add(1)
+	assert.Error(t, session.Save(stale))
+
+	output := logs.String()
+	assert.Contains(t, output, "level=DEBUG msg=\"store operation\" stream=Calculator:c1")
+	assert.Contains(t, output, "operation=save_events tenant=default duration=1ms events=1")
+	assert.Contains(t, output, "level=ERROR msg=\"store operation failed\"")
+	assert.Contains(t, output, "msg=\"tenant operation\" operation=new_tenant tenant=default")
+	assert.Equal(t, 1.0, metrics.counter(MetricStoreOperations,
+		MetricLabels{"operation": "save_events", "tenant": "default", "status": "error"}))
+}
+
+func TestInstrumentedStoreDoesNotCountFailedSaves(t *testing.T) {
+	metrics := &recordingMetrics{}
+	session := createInstrumentedSession(t, metrics, &bytes.Buffer{})
+	defer session.Close()
+
+	calc := newCalculator("c1")
+	calc.add(2)
+	assert.NoError(t, session.Save(calc))
+	stale := newCalculator("c1")
+	stale.add(1)
+	stale.add(3)
+	assert.ErrorIs(t, session.Save(stale), ErrConcurrencyConflict)
+
+	assert.Equal(t, 1.0, metrics.counter(MetricStoreEvents,
+		MetricLabels{"operation": "save_events", "tenant": "default"}))
+	assert.Equal(t, 1.0, metrics.counter(MetricStoreOperations,
+		MetricLabels{"operation": "save_events", "tenant": "default", "status": "error"}))
+}
@@ -0,0 +1,81 @@
+package moments
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// SubjectId identifies the person or entity personal data belongs to.
+type SubjectId string
+
+// ErrKeyNotFound is returned by a KeyStore for subjects without a key, including
+// subjects whose key was deleted.
+var ErrKeyNotFound = errors.New("key not found")
+
+// ErrSubjectForgotten is returned by a KeyStore for subjects whose key was deleted.
+// It wraps ErrKeyNotFound.
+var ErrSubjectForgotten = fmt.Errorf("subject forgotten: %w", ErrKeyNotFound)
+
+// KeyStore holds the encryption key of each subject.
+type KeyStore interface {
+	// GetOrCreateKey returns the subject's key, generating one when it has none.
+	// It returns ErrSubjectForgotten once the subject's key has been deleted, as a new
+	// key would leave the subject's earlier data undecryptable rather than erased.
+	GetOrCreateKey(subject SubjectId) ([]byte, error)
+	// Key returns the subject's key or ErrKeyNotFound.
+	Key(subject SubjectId) ([]byte, error)
+	// DeleteKey permanently deletes the subject's key, remembering that the subject was forgotten.
+	DeleteKey(subject SubjectId) error
+}
+
+// MemoryKeyStore is a KeyStore holding 256 bit keys in memory.
+type MemoryKeyStore struct {
+	mu   sync.RWMutex
+	keys map[SubjectId][]byte
+	// forgotten holds a tombstone for each subject whose key was deleted
+	forgotten map[SubjectId]bool
+}
+
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{keys: map[SubjectId][]byte{}, forgotten: map[SubjectId]bool{}}
+}
+
+func (s *MemoryKeyStore) GetOrCreateKey(subject SubjectId) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key, ok := s.keys[subject]; ok {
+		return key, nil
+	}
+	if s.forgotten[subject] {
+		return nil, fmt.Errorf("%w: %v", ErrSubjectForgotten, subject)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	s.keys[subject] = key
+	return key, nil
+}
+
+func (s *MemoryKeyStore) Key(subject SubjectId) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[subject]
+	if s.forgotten[subject] {
+		return nil, fmt.Errorf("%w: %v", ErrSubjectForgotten, subject)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrKeyNotFound, subject)
+	}
+	return key, nil
+}
+
+func (s *MemoryKeyStore) DeleteKey(subject SubjectId) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, subject)
+	s.forgotten[subject] = true
+	return nil
+}
@@ -1,9 +1,10 @@
 package moments
 
 import (
-	"encoding/json"
-	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 )
 
 type MemoryStore struct {
@@ -20,87 +21,132 @@ func (s *MemoryStore) Close() {
 }
 
 func (s *MemoryStore) SaveSnapshot(snapshot *Snapshot) error {
-	id := snapshot.Id
-	s.state.snapshots[id] = *snapshot
+	encoded, err := s.config.encodeSnapshot(*snapshot)
+	if err != nil {
+		return err
+	}
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	s.state.snapshots[encoded.Id] = encoded
 	return nil
 }
 
 func (s *MemoryStore) LoadSnapshot(id SnapshotId) (*Snapshot, error) {
+	s.state.mu.RLock()
 	ss, ok := s.state.snapshots[id]
+	s.state.mu.RUnlock()
 	if !ok {
 		return nil, nil
 	}
+	ss, err := s.config.decodeSnapshot(ss)
+	if err != nil {
+		return nil, err
+	}
 	return &ss, nil
 }
 
+// Snapshots returns every snapshot in the store, ordered by stream.
+func (s *MemoryStore) Snapshots() ([]Snapshot, error) {
+	s.state.mu.RLock()
+	stored := slices.Collect(maps.Values(s.state.snapshots))
+	s.state.mu.RUnlock()
+	slices.SortFunc(stored, func(a, b Snapshot) int {
+		return strings.Compare(a.Id.String(), b.Id.String())
+	})
+	snapshots := make([]Snapshot, len(stored))
+	for i, snapshot := range stored {
+		decoded, err := s.config.decodeSnapshot(snapshot)
+		if err != nil {
+			return nil, err
+		}
+		snapshots[i] = decoded
+	}
+	return snapshots, nil
+}
+
 func (s *MemoryStore) DeleteSnapshot(id SnapshotId) error {
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
 	delete(s.state.snapshots, id)
 	return nil
 }
 
-func (s MemoryStore) SaveEvents(args SaveEventArgs) error {
+func (s *MemoryStore) SaveEvents(args SaveEventArgs) error {
 	streamId := args.StreamId
 	events := args.Events
 	expectedVersion := args.ExpectedVersion
-	correlationId := args.CorrelationId
-	causationId := args.CausationId
-	metadata := args.Metadata
 	snapshot := args.Snapshot
 
 	state := s.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
 	stream, streamExists := state.streams[streamId]
-
 	if !streamExists {
 		stream = &Stream{StreamId: streamId}
 	}
-	streamEvents, eventsExist := state.eventsMap[streamId]
-	if !eventsExist {
-		streamEvents = []PersistedEvent{}
-	}
-	endVersion := stream.Version + Version(len(events))
-	if expectedVersion != Version(endVersion) {
-		return errors.New(fmt.Sprintln("Unexpected version. expected", expectedVersion, "actual", endVersion))
+
+	// Build and serialise everything up front so a failure leaves the store untouched.
+	baseSequence := state.sequence.Load()
+	persisted, err := s.config.persistEvents(args, eventLogHead{
+		version:    stream.Version,
+		sequence:   Sequence(baseSequence),
+		streamHash: lastHash(state.eventsMap[streamId]),
+		logHash:    lastHash(state.events),
+	})
+	if err != nil {
+		return err
 	}
-	for _, evt := range events {
-		seq := Sequence(state.sequence.Add(1))
-		pe := evt.ToPersistedEvent(stream.StreamId, seq, seq,
-			stream.Version+1, correlationId, causationId, metadata)
-		streamEvents = append(streamEvents, pe)
-		state.events = append(state.events, pe)
-		stream.Version++
-		data, err := json.Marshal(pe.Data)
-		if err != nil {
+	eventData := make([][]byte, len(events))
+	for i := range persisted {
+		pe := &persisted[i]
+		if eventData[i], err = s.encodeEvent(*pe, pe.Payload); err != nil {
 			return err
 		}
+		// Only the serialised form is kept, as a durable store would.
 		pe.Data = nil
-		state.eventData[seq] = data
+		pe.Payload = nil
+	}
+
+	var encodedSnapshot Snapshot
+	if snapshot != nil {
+		if encodedSnapshot, err = s.config.encodeSnapshot(*snapshot); err != nil {
+			return err
+		}
 	}
+
+	for i, pe := range persisted {
+		state.eventData[pe.Sequence] = eventData[i]
+		state.eventsMap[streamId] = append(state.eventsMap[streamId], pe)
+		state.events = append(state.events, pe)
+	}
+	state.sequence.Store(baseSequence + uint64(len(persisted)))
+	stream.Version = expectedVersion
 	if snapshot != nil {
-		state.snapshots[snapshot.Id] = *snapshot
+		state.snapshots[snapshot.Id] = encodedSnapshot
 	}
 	if !streamExists {
 		state.streams[streamId] = stream
 	}
-	if !eventsExist {
-		state.eventsMap[streamId] = streamEvents
-	}
 	return nil
 }
 
-func (s MemoryStore) LoadEvents(
+func (s *MemoryStore) LoadEvents(
 	options LoadEventArgs,
 ) ([]PersistedEvent, error) {
 	state := s.state
-	events := state.events
+	state.mu.RLock()
+	defer state.mu.RUnlock()
 	fromVersion := options.FromVersion
 	toVersion := options.ToVersion
 	fromSequence := options.FromSequence
 	toSequence := options.ToSequence
+	toTimestamp := options.ToTimestamp
 	streamId := options.StreamId
 	count := options.Count
 
-	if events == nil {
-		return []PersistedEvent{}, nil
+	events := state.events
+	if streamId.Id != "" {
+		events = state.eventsMap[streamId]
 	}
 	re := filterSlice(events, func(evt PersistedEvent) bool {
 		if fromVersion != 0 && evt.Version < fromVersion {
@@ -115,24 +161,138 @@ func (s MemoryStore) LoadEvents(
 		if toSequence != 0 && evt.Sequence > toSequence {
 			return false
 		}
-		if streamId.Id != "" && evt.StreamId != streamId {
+		if !toTimestamp.IsZero() && evt.Timestamp.After(toTimestamp) {
 			return false
 		}
 		return true
 	})
-	if count != 0 {
+	if options.Descending {
+		slices.Reverse(re)
+	}
+	if count != 0 && int(count) < len(re) {
 		re = re[:count]
 	}
-	for _, evt := range re {
-		data, ok := state.eventData[evt.Sequence]
-		if !ok {
-			return nil, fmt.Errorf("missing event data for sequence %v", evt.Sequence)
+	for i, evt := range re {
+		payload, err := s.payload(evt)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.config.verifySignature(evt, payload); err != nil {
+			return nil, err
 		}
-		dataValue, err := s.config.EventDeserialiser.Deserialise(evt.EventType, data)
+		dataValue, err := s.config.unmarshalEvent(evt.EventType, evt.ContentType, payload)
 		if err != nil {
 			return nil, err
 		}
 		evt.Data = dataValue
+		// Callers and load middleware must not be able to modify stored metadata
+		evt.Metadata = maps.Clone(evt.Metadata)
+		re[i] = evt
 	}
 	return re, nil
 }
+
+// ImportEvents appends events persisted by another store. Each event must continue the
+// tenant's sequence and its stream's version. Content types and hashes are kept as they are.
+// An event's Payload is stored when set, otherwise its Data is serialised again, and
+// events with a Hash must match it.
+func (s *MemoryStore) ImportEvents(events []PersistedEvent) error {
+	state := s.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	sequence := Sequence(state.sequence.Load())
+	versions := map[StreamId]Version{}
+	events = slices.Clone(events)
+	eventData := make([][]byte, len(events))
+	for i := range events {
+		evt := &events[i]
+		version, ok := versions[evt.StreamId]
+		if !ok {
+			if stream, exists := state.streams[evt.StreamId]; exists {
+				version = stream.Version
+			}
+		}
+		if evt.Sequence != sequence+1 || evt.Version != version+1 {
+			return fmt.Errorf("%w: cannot import %v version %v at sequence %v, store is at sequence %v",
+				ErrConcurrencyConflict, evt.StreamId, evt.Version, evt.Sequence, sequence)
+		}
+		payload := evt.Payload
+		if payload == nil {
+			var err error
+			if payload, err = s.config.marshalEvent(evt); err != nil {
+				return err
+			}
+		}
+		if evt.Hash != "" {
+			hash, err := eventHash(*evt, payload)
+			if err != nil {
+				return err
+			}
+			if hash != evt.Hash {
+				return fmt.Errorf("cannot import %v version %v, it does not match its hash", evt.StreamId, evt.Version)
+			}
+		}
+		data, err := s.encodeEvent(*evt, payload)
+		if err != nil {
+			return err
+		}
+		eventData[i] = data
+		sequence = evt.Sequence
+		versions[evt.StreamId] = evt.Version
+	}
+
+	for i, evt := range events {
+		evt.Data = nil
+		evt.Payload = nil
+		evt.Metadata = maps.Clone(evt.Metadata)
+		state.eventData[evt.Sequence] = eventData[i]
+		state.eventsMap[evt.StreamId] = append(state.eventsMap[evt.StreamId], evt)
+		state.events = append(state.events, evt)
+	}
+	for streamId, version := range versions {
+		stream, exists := state.streams[streamId]
+		if !exists {
+			stream = &Stream{StreamId: streamId}
+			state.streams[streamId] = stream
+		}
+		stream.Version = version
+	}
+	state.sequence.Store(uint64(sequence))
+	return nil
+}
+
+// encodeEvent runs the payload codecs over an event's serialised data.
+func (s *MemoryStore) encodeEvent(evt PersistedEvent, payload []byte) ([]byte, error) {
+	return s.config.encodePayload(PayloadInfo{Kind: EventPayload, StreamId: evt.StreamId, Version: evt.Version}, payload)
+}
+
+// payload returns an event's data as serialised by its EventSerialiser. Requires state.mu.
+func (s *MemoryStore) payload(evt PersistedEvent) ([]byte, error) {
+	data, ok := s.state.eventData[evt.Sequence]
+	if !ok {
+		return nil, fmt.Errorf("missing event data for sequence %v", evt.Sequence)
+	}
+	return s.config.decodePayload(PayloadInfo{Kind: EventPayload, StreamId: evt.StreamId, Version: evt.Version}, data)
+}
+
+// VerifyStream walks the stream's events and returns the first broken link in its hash chain.
+func (s *MemoryStore) VerifyStream(streamId StreamId) (*BrokenLink, error) {
+	s.state.mu.RLock()
+	defer s.state.mu.RUnlock()
+	return verifyChain(s.state.eventsMap[streamId], s.payload, false)
+}
+
+// VerifyLog walks the tenant's events and returns the first broken link in its hash chain.
+func (s *MemoryStore) VerifyLog() (*BrokenLink, error) {
+	s.state.mu.RLock()
+	defer s.state.mu.RUnlock()
+	return verifyChain(s.state.events, s.payload, true)
+}
+
+func lastHash(events []PersistedEvent) string {
+	if len(events) == 0 {
+		return ""
+	}
+	return events[len(events)-1].Hash
+}
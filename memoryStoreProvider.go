@@ -1,8 +1,12 @@
 package moments
 
 import (
+	"cmp"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"sync/atomic"
 )
 
@@ -20,6 +24,8 @@ func NewMemoryStoreProvider(config *Config) *MemoryStoreProvider {
 
 func (p *MemoryStoreProvider) NewTenant(tenant TenantId) error {
 	state := p.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
 	if _, exists := state.tenants[tenant]; exists {
 		return errors.New(fmt.Sprintln("Tenant already exists", tenant))
 	}
@@ -35,17 +41,23 @@ func (p *MemoryStoreProvider) NewTenant(tenant TenantId) error {
 }
 
 func (p *MemoryStoreProvider) TenantExists(id TenantId) (bool, error) {
+	p.state.mu.RLock()
+	defer p.state.mu.RUnlock()
 	_, exists := p.state.tenants[id]
 	return exists, nil
 }
 
 func (p *MemoryStoreProvider) DeleteTenant(tenant TenantId) error {
+	p.state.mu.Lock()
+	defer p.state.mu.Unlock()
 	delete(p.state.tenants, tenant)
 	return nil
 }
 
 func (p *MemoryStoreProvider) NewStore(tenant TenantId) (Store, error) {
 	state := p.state
+	state.mu.RLock()
+	defer state.mu.RUnlock()
 	tenantState, exists := state.tenants[tenant]
 	if !exists {
 		return nil, errors.New(fmt.Sprintln("Tenant doesnt exist", tenant))
@@ -56,3 +68,159 @@ func (p *MemoryStoreProvider) NewStore(tenant TenantId) (Store, error) {
 
 func (p *MemoryStoreProvider) Close() {
 }
+
+// StoreProviderSnapshotter is implemented by store providers whose entire state can be
+// captured and restored, allowing replicated providers to compact their logs.
+type StoreProviderSnapshotter interface {
+	SnapshotState() ([]byte, error)
+	RestoreState(data []byte) error
+}
+
+type memoryStoreSnapshot struct {
+	Tenants []memoryStoreTenantSnapshot
+}
+
+type memoryStoreTenantSnapshot struct {
+	Tenant    TenantId
+	Streams   []Stream
+	Events    []PersistedEvent
+	EventData [][]byte
+	Sequence  uint64
+	Snapshots []Snapshot
+}
+
+// SnapshotState serialises every tenant held by the provider.
+func (p *MemoryStoreProvider) SnapshotState() ([]byte, error) {
+	p.state.mu.RLock()
+	defer p.state.mu.RUnlock()
+	snapshot := memoryStoreSnapshot{}
+	for _, tenant := range slices.Sorted(maps.Keys(p.state.tenants)) {
+		state := p.state.tenants[tenant]
+		state.mu.RLock()
+		ts := memoryStoreTenantSnapshot{
+			Tenant:    tenant,
+			Events:    state.events,
+			EventData: make([][]byte, len(state.events)),
+			Sequence:  state.sequence.Load(),
+		}
+		for _, stream := range state.streams {
+			ts.Streams = append(ts.Streams, *stream)
+		}
+		for i, evt := range state.events {
+			ts.EventData[i] = state.eventData[evt.Sequence]
+		}
+		for _, ss := range state.snapshots {
+			ts.Snapshots = append(ts.Snapshots, ss)
+		}
+		state.mu.RUnlock()
+		snapshot.Tenants = append(snapshot.Tenants, ts)
+	}
+	return json.Marshal(snapshot)
+}
+
+// RestoreState replaces the provider's tenants with those in a snapshot taken by SnapshotState.
+// Stores created before the restore observe the restored state.
+func (p *MemoryStoreProvider) RestoreState(data []byte) error {
+	var snapshot memoryStoreSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+	p.state.mu.Lock()
+	defer p.state.mu.Unlock()
+	restored := map[TenantId]bool{}
+	for _, ts := range snapshot.Tenants {
+		restored[ts.Tenant] = true
+		state, exists := p.state.tenants[ts.Tenant]
+		if !exists {
+			state = &MemoryStoreTenantState{}
+			p.state.tenants[ts.Tenant] = state
+		}
+		state.mu.Lock()
+		state.streams = map[StreamId]*Stream{}
+		state.eventsMap = map[StreamId][]PersistedEvent{}
+		state.events = []PersistedEvent{}
+		state.eventData = make(map[Sequence][]byte)
+		state.snapshots = map[SnapshotId]Snapshot{}
+		state.sequence.Store(ts.Sequence)
+		for _, stream := range ts.Streams {
+			state.streams[stream.StreamId] = &stream
+		}
+		for i, evt := range ts.Events {
+			state.events = append(state.events, evt)
+			state.eventsMap[evt.StreamId] = append(state.eventsMap[evt.StreamId], evt)
+			state.eventData[evt.Sequence] = ts.EventData[i]
+		}
+		for _, ss := range ts.Snapshots {
+			state.snapshots[ss.Id] = ss
+		}
+		state.mu.Unlock()
+	}
+	for tenant := range p.state.tenants {
+		if !restored[tenant] {
+			delete(p.state.tenants, tenant)
+		}
+	}
+	return nil
+}
+
+// Tenants returns the ids of every tenant in the provider.
+func (p *MemoryStoreProvider) Tenants() ([]TenantId, error) {
+	p.state.mu.RLock()
+	defer p.state.mu.RUnlock()
+	return slices.Sorted(maps.Keys(p.state.tenants)), nil
+}
+
+// ReadFeed returns up to count of the tenant's events after the given GlobalSequence.
+// Load middleware is not run and each event's Payload is set, so events are replicated
+// exactly as they were stored.
+func (p *MemoryStoreProvider) ReadFeed(tenant TenantId, after Sequence, count uint) ([]PersistedEvent, error) {
+	state, err := p.tenantState(tenant)
+	if err != nil {
+		return nil, err
+	}
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	start, _ := slices.BinarySearchFunc(state.events, after+1, func(evt PersistedEvent, seq Sequence) int {
+		return cmp.Compare(evt.GlobalSequence, seq)
+	})
+	end := len(state.events)
+	if count != 0 {
+		end = min(end, start+int(count))
+	}
+	events := slices.Clone(state.events[start:end])
+	store := NewMemoryStore(state, p.config)
+	for i := range events {
+		evt := &events[i]
+		payload, err := store.payload(*evt)
+		if err != nil {
+			return nil, err
+		}
+		data, err := p.config.unmarshalEvent(evt.EventType, evt.ContentType, payload)
+		if err != nil {
+			return nil, err
+		}
+		evt.Data = data
+		evt.Payload = payload
+		evt.Metadata = maps.Clone(evt.Metadata)
+	}
+	return events, nil
+}
+
+// HeadSequence returns the GlobalSequence of the tenant's latest event.
+func (p *MemoryStoreProvider) HeadSequence(tenant TenantId) (Sequence, error) {
+	state, err := p.tenantState(tenant)
+	if err != nil {
+		return 0, err
+	}
+	return Sequence(state.sequence.Load()), nil
+}
+
+func (p *MemoryStoreProvider) tenantState(tenant TenantId) (*MemoryStoreTenantState, error) {
+	p.state.mu.RLock()
+	defer p.state.mu.RUnlock()
+	state, exists := p.state.tenants[tenant]
+	if !exists {
+		return nil, errors.New(fmt.Sprintln("Tenant doesnt exist", tenant))
+	}
+	return state, nil
+}
@@ -1,14 +1,17 @@
 package moments
 
 import (
+	"sync"
 	"sync/atomic"
 )
 
 type MemoryStoreState struct {
+	mu      sync.RWMutex
 	tenants map[TenantId]*MemoryStoreTenantState
 }
 
 type MemoryStoreTenantState struct {
+	mu        sync.RWMutex
 	streams   map[StreamId]*Stream
 	eventsMap map[StreamId][]PersistedEvent
 	events    []PersistedEvent
@@ -16,34 +16,32 @@ func createEventDeserialiser() *EventDeserialiser {
 }
 
 func createEventSourcedSession(t *testing.T) *Session {
-	config := Config{
+	return createSession(t, Config{
 		Aggregates: map[AggregateType]AggregateConfig{
 			"Calculator": {StoreStrategy: eventSourced},
 		},
 		EventDeserialiser:  createEventDeserialiser(),
 		SnapshotSerialiser: &JsonSnapshotSerialiser,
-	}
-	var provider StoreProvider = NewMemoryStoreProvider(&config)
-	provider.NewTenant("default")
-	sessionProvider := NewSessionProvider(provider, config)
-	session, err := sessionProvider.NewSession("default")
-	if err != nil {
-		t.Error(err)
-	}
-	return session
+	})
 }
 
 func createSnapshotSession(t *testing.T) *Session {
-	config := Config{
+	return createSession(t, Config{
 		Aggregates: map[AggregateType]AggregateConfig{
 			"Calculator": {StoreStrategy: alwaysSnapshot},
 		},
 		EventDeserialiser:  createEventDeserialiser(),
 		SnapshotSerialiser: &JsonSnapshotSerialiser,
-	}
+	})
+}
+
+func createSession(t *testing.T, config Config) *Session {
 	var provider StoreProvider = NewMemoryStoreProvider(&config)
 	provider.NewTenant("default")
-	sessionProvider := NewSessionProvider(provider, config)
+	sessionProvider, err := NewSessionProvider(provider, config)
+	if err != nil {
+		t.Fatal(err)
+	}
 	session, err := sessionProvider.NewSession("default")
 	if err != nil {
 		t.Error(err)
@@ -170,3 +168,87 @@ func TestLoadAndSave(t *testing.T) {
 	assert.Equal(t, Version(1), loadedEvents[0].Version)
 	session.Close()
 }
+
+func TestLoadEventsReturnsDeserialisedData(t *testing.T) {
+	session := createEventSourcedSession(t)
+	calc := newCalculator("")
+	calc.update(5)
+	calc.add(10)
+	err := session.Save(calc)
+	assert.Nil(t, err)
+
+	events, err := session.LoadStream(calc.StreamId())
+	assert.Nil(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, calculator_updated_v1{Value: 5}, events[0].Data)
+	assert.Equal(t, calculator_added_v1{Value: 10}, events[1].Data)
+	session.Close()
+}
+
+func TestSaveEventsStoresSerialisedData(t *testing.T) {
+	session := createEventSourcedSession(t)
+	calc := newCalculator("")
+	calc.add(3)
+	err := session.Save(calc)
+	assert.Nil(t, err)
+
+	state := session.Store.(*MemoryStore).state
+	assert.Nil(t, state.events[0].Data)
+	assert.Nil(t, state.eventsMap[calc.StreamId()][0].Data)
+	assert.JSONEq(t, `{"Value":3}`, string(state.eventData[state.events[0].Sequence]))
+	session.Close()
+}
+
+func TestAppendToExistingStreamUpdatesStreamIndex(t *testing.T) {
+	session := createEventSourcedSession(t)
+	calc := newCalculator("")
+	calc.update(5)
+	err := session.Save(calc)
+	assert.Nil(t, err)
+	calc.add(2)
+	calc.subtract(1)
+	err = session.Save(calc)
+	assert.Nil(t, err)
+
+	state := session.Store.(*MemoryStore).state
+	assert.Len(t, state.eventsMap[calc.StreamId()], 3)
+	assert.Equal(t, Version(3), state.streams[calc.StreamId()].Version)
+
+	loadedCalc := newCalculator(calc.Id())
+	err = session.LoadAggregate(loadedCalc)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, loadedCalc.State().Value)
+	assert.Equal(t, Version(3), loadedCalc.Version())
+	session.Close()
+}
+
+func TestLoadEventsCountLargerThanResult(t *testing.T) {
+	session := createEventSourcedSession(t)
+	calc := newCalculator("")
+	calc.add(1)
+	err := session.Save(calc)
+	assert.Nil(t, err)
+
+	events, err := session.LoadEvents(LoadEventArgs{StreamId: calc.StreamId(), Count: 10})
+	assert.Nil(t, err)
+	assert.Len(t, events, 1)
+	session.Close()
+}
+
+func TestSaveEventsWithUnexpectedVersionLeavesStoreUntouched(t *testing.T) {
+	session := createEventSourcedSession(t)
+	calc := newCalculator("")
+	calc.add(1)
+	err := session.Save(calc)
+	assert.Nil(t, err)
+
+	stale := newCalculator(calc.Id())
+	stale.add(2)
+	err = session.Save(stale)
+	assert.NotNil(t, err)
+
+	events, err := session.LoadStream(calc.StreamId())
+	assert.Nil(t, err)
+	assert.Len(t, events, 1)
+	session.Close()
+}
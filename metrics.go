@@ -0,0 +1,28 @@
+package moments
+
+// MetricLabels are the dimensions attached to a metric observation.
+type MetricLabels map[string]string
+
+// Metrics records counters and histograms. Implement it to forward to a metrics
+// system such as Prometheus without the library depending on it.
+type Metrics interface {
+	IncCounter(name string, value float64, labels MetricLabels)
+	ObserveHistogram(name string, value float64, labels MetricLabels)
+}
+
+const (
+	// MetricStoreOperations counts store calls by operation, tenant and status.
+	MetricStoreOperations = "moments_store_operations_total"
+	// MetricStoreOperationSeconds observes store call latency by operation and tenant.
+	MetricStoreOperationSeconds = "moments_store_operation_duration_seconds"
+	// MetricStoreEvents counts events saved and loaded by operation and tenant.
+	MetricStoreEvents = "moments_store_events_total"
+)
+
+type noopMetrics struct{}
+
+func (noopMetrics) IncCounter(name string, value float64, labels MetricLabels)       {}
+func (noopMetrics) ObserveHistogram(name string, value float64, labels MetricLabels) {}
+
+// NoopMetrics discards all metrics.
+var NoopMetrics Metrics = noopMetrics{}
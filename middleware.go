@@ -0,0 +1,95 @@
+package moments
+
+import (
+	"context"
+	"errors"
+)
+
+// EventMiddleware inspects or modifies an event as a session saves or loads it. Middleware
+// runs in the session, so it applies to every Store and runs once for each event saved.
+// Save middleware can enrich Metadata or Data, or reject the write by returning an error.
+// It runs before the store sequences the events, so their Sequence and GlobalSequence are zero.
+// Load middleware can decorate events, or filter them out by returning ErrSkipEvent,
+// except when an aggregate is being rebuilt, see IsAggregateLoad.
+// Middleware must not change an event's stream, sequence or version.
+type EventMiddleware func(ctx context.Context, event *PersistedEvent) error
+
+// ErrSkipEvent is returned by load middleware to drop an event from the loaded results.
+var ErrSkipEvent = errors.New("skip event")
+
+// beforeSave runs the save middleware chain on the events of a save before they are passed
+// to the store, replacing each event with the one the middleware leaves.
+func (c *Config) beforeSave(args *SaveEventArgs) error {
+	if len(c.SaveMiddleware) == 0 {
+		return nil
+	}
+	ctx := args.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	firstVersion := args.ExpectedVersion - Version(len(args.Events)) + 1
+	for i, evt := range args.Events {
+		event := evt.ToPersistedEvent(args.StreamId, 0, 0, firstVersion+Version(i),
+			args.CorrelationId, args.CausationId, args.Metadata)
+		for _, middleware := range c.SaveMiddleware {
+			if err := middleware(ctx, &event); err != nil {
+				return err
+			}
+		}
+		args.Events[i] = event.Event
+	}
+	return nil
+}
+
+// afterLoad runs the load middleware chain on loaded events, returning at most count of
+// the events kept, or all of them when count is 0. Skipped events are kept when an
+// aggregate is being rebuilt.
+func (c *Config) afterLoad(ctx context.Context, events []PersistedEvent, count uint) ([]PersistedEvent, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	loaded := make([]PersistedEvent, 0, len(events))
+	for _, event := range events {
+		if count != 0 && len(loaded) == int(count) {
+			break
+		}
+		keep, err := c.loadEvent(ctx, &event)
+		if err != nil {
+			return nil, err
+		}
+		if keep {
+			loaded = append(loaded, event)
+		}
+	}
+	return loaded, nil
+}
+
+// loadEvent runs the load middleware chain on an event, reporting whether it should be kept.
+func (c *Config) loadEvent(ctx context.Context, event *PersistedEvent) (bool, error) {
+	for _, middleware := range c.LoadMiddleware {
+		err := middleware(ctx, event)
+		if errors.Is(err, ErrSkipEvent) {
+			return IsAggregateLoad(ctx), nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+type aggregateLoadKey struct{}
+
+// withAggregateLoad marks loads made to rebuild an aggregate. Every event of the stream
+// must be applied for the aggregate to reach the stream's version, so load middleware
+// cannot skip events in these loads.
+func withAggregateLoad(ctx context.Context) context.Context {
+	return context.WithValue(ctx, aggregateLoadKey{}, true)
+}
+
+// IsAggregateLoad reports whether events are being loaded to rebuild an aggregate,
+// in which case ErrSkipEvent returned by load middleware is ignored.
+func IsAggregateLoad(ctx context.Context) bool {
+	loading, _ := ctx.Value(aggregateLoadKey{}).(bool)
+	return loading
+}
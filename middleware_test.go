@@ -0,0 +1,201 @@
+package moments
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type userKey struct{}
+
+func createMiddlewareSession(t *testing.T, save []EventMiddleware, load []EventMiddleware) *Session {
+	return createSession(t, Config{
+		Aggregates: map[AggregateType]AggregateConfig{
+			calculatorType: {StoreStrategy: eventSourced},
+		},
+		EventDeserialiser: createEventDeserialiser(),
+		SaveMiddleware:    save,
+		LoadMiddleware:    load,
+	})
+}
+
+func TestSaveMiddlewareEnrichesMetadata(t *testing.T) {
+	session := createMiddlewareSession(t, []EventMiddleware{
+		func(ctx context.Context, event *PersistedEvent) error {
+			event.Metadata["user"] = ctx.Value(userKey{})
+			return nil
+		},
+		func(ctx context.Context, event *PersistedEvent) error {
+			event.Metadata["app_version"] = "1.2.3"
+			return nil
+		},
+	}, nil)
+	defer session.Close()
+	session.Context = context.WithValue(context.Background(), userKey{}, "alice")
+
+	calc := newCalculator("")
+	calc.add(1)
+	assert.NoError(t, session.Save(calc))
+
+	events, err := session.LoadStream(calc.StreamId())
+	assert.NoError(t, err)
+	assert.Equal(t, Metadata{"user": "alice", "app_version": "1.2.3"}, events[0].Metadata)
+}
+
+func TestSaveMiddlewareRejectsWrite(t *testing.T) {
+	errRejected := errors.New("rejected")
+	session := createMiddlewareSession(t, []EventMiddleware{
+		func(ctx context.Context, event *PersistedEvent) error {
+			if e, ok := event.Data.(calculator_added_v1); ok && e.Value < 0 {
+				return errRejected
+			}
+			return nil
+		},
+	}, nil)
+	defer session.Close()
+
+	calc := newCalculator("")
+	calc.add(1)
+	calc.add(-1)
+	assert.ErrorIs(t, session.Save(calc), errRejected)
+
+	events, err := session.LoadEvents(LoadEventArgs{})
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+
+	calc = newCalculator("")
+	calc.add(1)
+	assert.NoError(t, session.Save(calc))
+	events, err = session.LoadStream(calc.StreamId())
+	assert.NoError(t, err)
+	assert.Equal(t, Sequence(1), events[0].Sequence)
+}
+
+func TestLoadMiddlewareDecoratesAndFilters(t *testing.T) {
+	session := createMiddlewareSession(t, nil, []EventMiddleware{
+		func(ctx context.Context, event *PersistedEvent) error {
+			if _, ok := event.Data.(calculator_subtracted_v1); ok {
+				return ErrSkipEvent
+			}
+			return nil
+		},
+		func(ctx context.Context, event *PersistedEvent) error {
+			event.Metadata["loaded"] = true
+			return nil
+		},
+	})
+	defer session.Close()
+
+	calc := newCalculator("")
+	calc.add(3)
+	calc.subtract(1)
+	calc.add(2)
+	assert.NoError(t, session.Save(calc))
+
+	events, err := session.LoadStream(calc.StreamId())
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	for _, evt := range events {
+		assert.IsType(t, calculator_added_v1{}, evt.Data)
+		assert.Equal(t, true, evt.Metadata["loaded"])
+	}
+}
+
+func TestLoadMiddlewareError(t *testing.T) {
+	errDenied := errors.New("denied")
+	session := createMiddlewareSession(t, nil, []EventMiddleware{
+		func(ctx context.Context, event *PersistedEvent) error {
+			return errDenied
+		},
+	})
+	defer session.Close()
+
+	calc := newCalculator("")
+	calc.add(3)
+	assert.NoError(t, session.Save(calc))
+
+	_, err := session.LoadStream(calc.StreamId())
+	assert.ErrorIs(t, err, errDenied)
+}
+
+func TestLoadMiddlewareDoesNotModifyStoredEvents(t *testing.T) {
+	session := createMiddlewareSession(t, nil, []EventMiddleware{
+		func(ctx context.Context, event *PersistedEvent) error {
+			event.Metadata["loaded"] = true
+			return nil
+		},
+	})
+	defer session.Close()
+
+	calc := newCalculator("")
+	calc.add(3)
+	assert.NoError(t, session.Save(calc))
+	_, err := session.LoadStream(calc.StreamId())
+	assert.NoError(t, err)
+
+	state := session.Store.(*MemoryStore).state
+	assert.NotContains(t, state.events[0].Metadata, "loaded")
+}
+
+func TestLoadMiddlewareDoesNotSkipEventsWhenRebuildingAggregates(t *testing.T) {
+	session := createMiddlewareSession(t, nil, []EventMiddleware{
+		func(ctx context.Context, event *PersistedEvent) error {
+			if _, ok := event.Data.(calculator_subtracted_v1); ok {
+				return ErrSkipEvent
+			}
+			return nil
+		},
+	})
+	defer session.Close()
+
+	calc := newCalculator("c1")
+	calc.add(3)
+	calc.subtract(1)
+	assert.NoError(t, session.Save(calc))
+
+	loaded := newCalculator("c1")
+	assert.NoError(t, session.LoadAggregate(loaded))
+	assert.Equal(t, Version(2), loaded.Version())
+	assert.Equal(t, 2, loaded.State().Value)
+	loaded.add(1)
+	assert.NoError(t, session.Save(loaded))
+
+	// Count applies to the events left once middleware has filtered them
+	events, err := session.LoadEvents(LoadEventArgs{Count: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []any{calculator_added_v1{Value: 3}, calculator_added_v1{Value: 1}},
+		mapSlice(events, func(e PersistedEvent) any { return e.Data }))
+}
+
+func TestMiddlewareRunsInTheSession(t *testing.T) {
+	session := createMiddlewareSession(t, []EventMiddleware{
+		func(ctx context.Context, event *PersistedEvent) error {
+			assert.Equal(t, Sequence(0), event.Sequence)
+			event.Metadata["version"] = event.Version
+			return nil
+		},
+	}, []EventMiddleware{
+		func(ctx context.Context, event *PersistedEvent) error {
+			event.Metadata["loaded"] = true
+			return nil
+		},
+	})
+	defer session.Close()
+
+	calc := newCalculator("c1")
+	calc.add(1)
+	calc.add(2)
+	assert.NoError(t, session.Save(calc))
+
+	// The store is given the events the save middleware left and returns them as stored
+	stored, err := session.Store.LoadEvents(LoadEventArgs{StreamId: calc.StreamId()})
+	assert.NoError(t, err)
+	assert.Equal(t, []Metadata{{"version": Version(1)}, {"version": Version(2)}},
+		mapSlice(stored, func(e PersistedEvent) Metadata { return e.Metadata }))
+
+	loaded, err := session.LoadStream(calc.StreamId())
+	assert.NoError(t, err)
+	assert.Equal(t, Metadata{"version": Version(2), "loaded": true}, loaded[1].Metadata)
+}
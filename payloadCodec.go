@@ -0,0 +1,76 @@
+package moments
+
+import "fmt"
+
+type PayloadKind int
+
+const (
+	EventPayload PayloadKind = iota
+	SnapshotPayload
+)
+
+func (k PayloadKind) String() string {
+	switch k {
+	case EventPayload:
+		return "Event"
+	case SnapshotPayload:
+		return "Snapshot"
+	default:
+		return "Unknown"
+	}
+}
+
+// PayloadInfo describes the record a payload belongs to.
+type PayloadInfo struct {
+	Kind     PayloadKind
+	StreamId StreamId
+	// Version is the event's version in its stream, or the version a snapshot was taken at.
+	Version Version
+}
+
+// PayloadCodec transforms the serialised bytes of event data and snapshot state as
+// stores write and read them. Decode must accept payloads the codec did not encode,
+// returning them unchanged, so records written before a codec was added remain readable,
+// unless the codec is configured to reject them.
+type PayloadCodec interface {
+	Encode(info PayloadInfo, data []byte) ([]byte, error)
+	Decode(info PayloadInfo, data []byte) ([]byte, error)
+}
+
+// encodePayload runs the configured payload codecs in order.
+func (c *Config) encodePayload(info PayloadInfo, data []byte) ([]byte, error) {
+	for _, codec := range c.PayloadCodecs {
+		encoded, err := codec.Encode(info, data)
+		if err != nil {
+			return nil, fmt.Errorf("encoding %v payload of %v: %w", info.Kind, info.StreamId, err)
+		}
+		data = encoded
+	}
+	return data, nil
+}
+
+// decodePayload runs the configured payload codecs in reverse order.
+func (c *Config) decodePayload(info PayloadInfo, data []byte) ([]byte, error) {
+	for i := len(c.PayloadCodecs) - 1; i >= 0; i-- {
+		decoded, err := c.PayloadCodecs[i].Decode(info, data)
+		if err != nil {
+			return nil, fmt.Errorf("decoding %v payload of %v: %w", info.Kind, info.StreamId, err)
+		}
+		data = decoded
+	}
+	return data, nil
+}
+
+// encodeSnapshot returns a copy of the snapshot with its state encoded.
+func (c *Config) encodeSnapshot(snapshot Snapshot) (Snapshot, error) {
+	state, err := c.encodePayload(PayloadInfo{Kind: SnapshotPayload, StreamId: snapshot.Id.StreamId, Version: snapshot.Version}, snapshot.State)
+	snapshot.State = state
+	return snapshot, err
+}
+
+// decodeSnapshot returns a copy of the snapshot with its state decoded.
+func (c *Config) decodeSnapshot(snapshot Snapshot) (Snapshot, error) {
+	state, err := c.decodePayload(PayloadInfo{Kind: SnapshotPayload, StreamId: snapshot.Id.StreamId, Version: snapshot.Version}, snapshot.State)
+	snapshot.State = state
+	return snapshot, err
+}
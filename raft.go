@@ -0,0 +1,814 @@
+package moments
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotLeader is returned when a node that is not the leader is asked to lead.
+	ErrNotLeader = errors.New("not the raft leader")
+	// ErrLeadershipLost is returned when a proposal's outcome is unknown because the
+	// leader lost leadership before it was applied.
+	ErrLeadershipLost = errors.New("raft leadership lost")
+	// ErrRaftTimeout is returned when a proposal or read could not complete in time.
+	ErrRaftTimeout = errors.New("raft request timed out")
+	// ErrRaftStopped is returned once a node has been stopped.
+	ErrRaftStopped = errors.New("raft node stopped")
+)
+
+// RaftConfig configures a node of a raft cluster.
+type RaftConfig struct {
+	// Id identifies this node within the cluster.
+	Id string
+	// Peers lists the ids of every node in the cluster, including this one.
+	Peers []string
+	// ElectionTimeout is the minimum time without hearing from a leader before
+	// starting an election. The actual timeout is randomised up to twice this. Defaults to 300ms.
+	ElectionTimeout time.Duration
+	// HeartbeatInterval is how often the leader replicates to followers. Defaults to 50ms.
+	HeartbeatInterval time.Duration
+	// RequestTimeout bounds how long proposals and reads wait. Defaults to 5s.
+	RequestTimeout time.Duration
+	// SnapshotThreshold is the number of applied entries after which the log is
+	// compacted into a snapshot. Zero disables snapshots.
+	SnapshotThreshold uint64
+	// LinearisableReads confirms leadership with a quorum before every read so that reads
+	// on any node observe all writes completed before them. Otherwise reads are served
+	// from the local store and may be stale on followers.
+	LinearisableReads bool
+}
+
+func (c RaftConfig) withDefaults() RaftConfig {
+	if c.ElectionTimeout == 0 {
+		c.ElectionTimeout = 300 * time.Millisecond
+	}
+	if c.HeartbeatInterval == 0 {
+		c.HeartbeatInterval = 50 * time.Millisecond
+	}
+	if c.RequestTimeout == 0 {
+		c.RequestTimeout = 5 * time.Second
+	}
+	return c
+}
+
+// raftStateMachine is the replicated state the log is applied to.
+type raftStateMachine interface {
+	// prepare turns a command submitted to the leader into the command appended to the log.
+	// It sees the state left by applying every entry before it.
+	prepare(command []byte) ([]byte, error)
+	apply(command []byte) error
+	snapshot() ([]byte, error)
+	restore(data []byte) error
+}
+
+type raftRole int
+
+const (
+	raftFollower raftRole = iota
+	raftCandidate
+	raftLeader
+)
+
+func (r raftRole) String() string {
+	switch r {
+	case raftFollower:
+		return "Follower"
+	case raftCandidate:
+		return "Candidate"
+	case raftLeader:
+		return "Leader"
+	default:
+		return "Unknown"
+	}
+}
+
+type raftWaiter struct {
+	term   uint64
+	result chan error
+}
+
+// raftNode implements the raft consensus protocol over an in memory log.
+type raftNode struct {
+	config    RaftConfig
+	transport RaftTransport
+	sm        raftStateMachine
+
+	// applyMu serialises access to the state machine
+	applyMu sync.Mutex
+	// prepareMu serialises proposals so each is prepared once the one before it is applied
+	prepareMu sync.Mutex
+	mu        sync.Mutex
+
+	role        raftRole
+	currentTerm uint64
+	votedFor    string
+	leaderId    string
+	votes       int
+
+	// log holds the entries after the snapshot, log[0] has index snapshotIndex+1
+	log           []RaftEntry
+	snapshotIndex uint64
+	snapshotTerm  uint64
+	snapshotData  []byte
+
+	commitIndex uint64
+	lastApplied uint64
+
+	nextIndex  map[string]uint64
+	matchIndex map[string]uint64
+	inflight   map[string]bool
+	// lastAck holds the send time of the latest request each peer acknowledged in the current term
+	lastAck map[string]time.Time
+
+	electionDeadline time.Time
+	lastHeartbeat    time.Time
+
+	waiters map[uint64]raftWaiter
+	// changed is closed and replaced whenever the commit, apply or ack state changes
+	changed chan struct{}
+	stopped bool
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newRaftNode(config RaftConfig, transport RaftTransport, sm raftStateMachine) *raftNode {
+	n := &raftNode{
+		config:     config.withDefaults(),
+		transport:  transport,
+		sm:         sm,
+		nextIndex:  map[string]uint64{},
+		matchIndex: map[string]uint64{},
+		inflight:   map[string]bool{},
+		lastAck:    map[string]time.Time{},
+		waiters:    map[uint64]raftWaiter{},
+		changed:    make(chan struct{}),
+		stopCh:     make(chan struct{}),
+	}
+	n.resetElectionDeadline()
+	transport.Listen(n)
+	return n
+}
+
+func (n *raftNode) start() {
+	n.wg.Add(2)
+	go n.run()
+	go n.runApplier()
+}
+
+func (n *raftNode) stop() {
+	n.mu.Lock()
+	if n.stopped {
+		n.mu.Unlock()
+		return
+	}
+	n.stopped = true
+	close(n.stopCh)
+	n.notifyChanged()
+	for index, waiter := range n.waiters {
+		waiter.result <- ErrRaftStopped
+		delete(n.waiters, index)
+	}
+	n.mu.Unlock()
+	n.wg.Wait()
+}
+
+func (n *raftNode) status() (raftRole, uint64, string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.role, n.currentTerm, n.leaderId
+}
+
+func (n *raftNode) run() {
+	defer n.wg.Done()
+	ticker := time.NewTicker(n.config.HeartbeatInterval / 5)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.stopCh:
+			return
+		case <-ticker.C:
+			n.tick()
+		}
+	}
+}
+
+func (n *raftNode) tick() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	now := time.Now()
+	if n.role == raftLeader {
+		if now.Sub(n.lastHeartbeat) >= n.config.HeartbeatInterval {
+			n.broadcast()
+		}
+		return
+	}
+	if now.After(n.electionDeadline) {
+		n.startElection()
+	}
+}
+
+func (n *raftNode) resetElectionDeadline() {
+	timeout := n.config.ElectionTimeout + rand.N(n.config.ElectionTimeout)
+	n.electionDeadline = time.Now().Add(timeout)
+}
+
+// notifyChanged wakes everything waiting on commit, apply or ack progress. Requires mu.
+func (n *raftNode) notifyChanged() {
+	close(n.changed)
+	n.changed = make(chan struct{})
+}
+
+func (n *raftNode) lastIndex() uint64 {
+	return n.snapshotIndex + uint64(len(n.log))
+}
+
+func (n *raftNode) termAt(index uint64) uint64 {
+	if index == n.snapshotIndex {
+		return n.snapshotTerm
+	}
+	if index < n.snapshotIndex || index > n.lastIndex() {
+		return 0
+	}
+	return n.log[index-n.snapshotIndex-1].Term
+}
+
+func (n *raftNode) entriesFrom(index uint64) []RaftEntry {
+	return n.log[index-n.snapshotIndex-1:]
+}
+
+func (n *raftNode) quorum() int {
+	return len(n.config.Peers)/2 + 1
+}
+
+func (n *raftNode) peers() []string {
+	return filterSlice(n.config.Peers, func(id string) bool { return id != n.config.Id })
+}
+
+// becomeFollower steps down into the given term. Requires mu.
+func (n *raftNode) becomeFollower(term uint64) {
+	if term > n.currentTerm {
+		n.currentTerm = term
+		n.votedFor = ""
+	}
+	n.role = raftFollower
+	n.notifyChanged()
+}
+
+func (n *raftNode) startElection() {
+	n.role = raftCandidate
+	n.currentTerm++
+	n.votedFor = n.config.Id
+	n.leaderId = ""
+	n.votes = 1
+	n.resetElectionDeadline()
+	if n.votes >= n.quorum() {
+		n.becomeLeader()
+		return
+	}
+	req := RequestVoteRequest{
+		Term:         n.currentTerm,
+		CandidateId:  n.config.Id,
+		LastLogIndex: n.lastIndex(),
+		LastLogTerm:  n.termAt(n.lastIndex()),
+	}
+	for _, peer := range n.peers() {
+		go n.requestVote(peer, req)
+	}
+}
+
+func (n *raftNode) requestVote(peer string, req RequestVoteRequest) {
+	resp, err := n.transport.RequestVote(peer, req)
+	if err != nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if resp.Term > n.currentTerm {
+		n.becomeFollower(resp.Term)
+		return
+	}
+	if n.role != raftCandidate || n.currentTerm != req.Term || !resp.VoteGranted {
+		return
+	}
+	n.votes++
+	if n.votes >= n.quorum() {
+		n.becomeLeader()
+	}
+}
+
+func (n *raftNode) becomeLeader() {
+	n.role = raftLeader
+	n.leaderId = n.config.Id
+	for _, peer := range n.peers() {
+		n.nextIndex[peer] = n.lastIndex() + 1
+		n.matchIndex[peer] = 0
+		delete(n.lastAck, peer)
+	}
+	// Committing an entry from the new term commits everything before it
+	n.log = append(n.log, RaftEntry{Term: n.currentTerm, Index: n.lastIndex() + 1})
+	n.advanceCommit()
+	n.broadcast()
+	slog.Debug("raft leader elected", "node", n.config.Id, "term", n.currentTerm)
+}
+
+// broadcast replicates the log to every follower. Requires mu.
+func (n *raftNode) broadcast() {
+	n.lastHeartbeat = time.Now()
+	for _, peer := range n.peers() {
+		if n.inflight[peer] {
+			continue
+		}
+		n.inflight[peer] = true
+		go n.replicate(peer)
+	}
+}
+
+func (n *raftNode) replicate(peer string) {
+	n.mu.Lock()
+	defer func() {
+		n.inflight[peer] = false
+		n.mu.Unlock()
+	}()
+	if n.role != raftLeader {
+		return
+	}
+	term := n.currentTerm
+	next := n.nextIndex[peer]
+	sent := time.Now()
+
+	if next <= n.snapshotIndex {
+		req := InstallSnapshotRequest{
+			Term:              term,
+			LeaderId:          n.config.Id,
+			LastIncludedIndex: n.snapshotIndex,
+			LastIncludedTerm:  n.snapshotTerm,
+			Data:              n.snapshotData,
+		}
+		n.mu.Unlock()
+		resp, err := n.transport.InstallSnapshot(peer, req)
+		n.mu.Lock()
+		if err != nil || !n.handleResponseTerm(resp.Term, term) {
+			return
+		}
+		n.recordAck(peer, sent)
+		n.matchIndex[peer] = max(n.matchIndex[peer], req.LastIncludedIndex)
+		n.nextIndex[peer] = n.matchIndex[peer] + 1
+		return
+	}
+
+	req := AppendEntriesRequest{
+		Term:         term,
+		LeaderId:     n.config.Id,
+		PrevLogIndex: next - 1,
+		PrevLogTerm:  n.termAt(next - 1),
+		Entries:      n.entriesFrom(next),
+		LeaderCommit: n.commitIndex,
+	}
+	n.mu.Unlock()
+	resp, err := n.transport.AppendEntries(peer, req)
+	n.mu.Lock()
+	if err != nil || !n.handleResponseTerm(resp.Term, term) {
+		return
+	}
+	n.recordAck(peer, sent)
+	if !resp.Success {
+		n.nextIndex[peer] = max(1, min(req.PrevLogIndex, resp.LastLogIndex+1))
+		return
+	}
+	n.matchIndex[peer] = max(n.matchIndex[peer], req.PrevLogIndex+uint64(len(req.Entries)))
+	n.nextIndex[peer] = n.matchIndex[peer] + 1
+	n.advanceCommit()
+}
+
+// handleResponseTerm steps down if a peer has seen a later term and reports whether
+// this node is still leading the term the request was sent in. Requires mu.
+func (n *raftNode) handleResponseTerm(responseTerm uint64, requestTerm uint64) bool {
+	if responseTerm > n.currentTerm {
+		n.becomeFollower(responseTerm)
+		return false
+	}
+	return n.role == raftLeader && n.currentTerm == requestTerm
+}
+
+func (n *raftNode) recordAck(peer string, sent time.Time) {
+	if sent.After(n.lastAck[peer]) {
+		n.lastAck[peer] = sent
+		n.notifyChanged()
+	}
+}
+
+// advanceCommit commits the latest entry of the current term stored on a quorum. Requires mu.
+func (n *raftNode) advanceCommit() {
+	for index := n.lastIndex(); index > n.commitIndex; index-- {
+		if n.termAt(index) != n.currentTerm {
+			return
+		}
+		count := 1
+		for _, peer := range n.peers() {
+			if n.matchIndex[peer] >= index {
+				count++
+			}
+		}
+		if count >= n.quorum() {
+			n.commitIndex = index
+			n.notifyChanged()
+			return
+		}
+	}
+}
+
+func (n *raftNode) HandleRequestVote(req RequestVoteRequest) RequestVoteResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if req.Term < n.currentTerm {
+		return RequestVoteResponse{Term: n.currentTerm}
+	}
+	if req.Term > n.currentTerm {
+		n.becomeFollower(req.Term)
+	}
+	lastTerm := n.termAt(n.lastIndex())
+	upToDate := req.LastLogTerm > lastTerm ||
+		(req.LastLogTerm == lastTerm && req.LastLogIndex >= n.lastIndex())
+	if (n.votedFor == "" || n.votedFor == req.CandidateId) && upToDate {
+		n.votedFor = req.CandidateId
+		n.resetElectionDeadline()
+		return RequestVoteResponse{Term: n.currentTerm, VoteGranted: true}
+	}
+	return RequestVoteResponse{Term: n.currentTerm}
+}
+
+func (n *raftNode) HandleAppendEntries(req AppendEntriesRequest) AppendEntriesResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if req.Term < n.currentTerm {
+		return AppendEntriesResponse{Term: n.currentTerm, LastLogIndex: n.lastIndex()}
+	}
+	if req.Term > n.currentTerm || n.role != raftFollower {
+		n.becomeFollower(req.Term)
+	}
+	n.leaderId = req.LeaderId
+	n.resetElectionDeadline()
+
+	if req.PrevLogIndex > n.lastIndex() {
+		return AppendEntriesResponse{Term: n.currentTerm, LastLogIndex: n.lastIndex()}
+	}
+	if req.PrevLogIndex >= n.snapshotIndex && n.termAt(req.PrevLogIndex) != req.PrevLogTerm {
+		return AppendEntriesResponse{Term: n.currentTerm, LastLogIndex: req.PrevLogIndex - 1}
+	}
+	for _, entry := range req.Entries {
+		if entry.Index <= n.snapshotIndex {
+			continue
+		}
+		if entry.Index <= n.lastIndex() {
+			if n.termAt(entry.Index) == entry.Term {
+				continue
+			}
+			n.log = n.log[:entry.Index-n.snapshotIndex-1]
+		}
+		n.log = append(n.log, entry)
+	}
+	// A delayed request can end before entries already known to be committed,
+	// so the commit index only ever moves forward
+	lastNew := req.PrevLogIndex + uint64(len(req.Entries))
+	if commit := min(req.LeaderCommit, lastNew); commit > n.commitIndex {
+		n.commitIndex = commit
+		n.notifyChanged()
+	}
+	return AppendEntriesResponse{Term: n.currentTerm, Success: true, LastLogIndex: n.lastIndex()}
+}
+
+func (n *raftNode) HandleInstallSnapshot(req InstallSnapshotRequest) InstallSnapshotResponse {
+	n.applyMu.Lock()
+	defer n.applyMu.Unlock()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if req.Term < n.currentTerm {
+		return InstallSnapshotResponse{Term: n.currentTerm}
+	}
+	if req.Term > n.currentTerm || n.role != raftFollower {
+		n.becomeFollower(req.Term)
+	}
+	n.leaderId = req.LeaderId
+	n.resetElectionDeadline()
+	if req.LastIncludedIndex <= n.lastApplied {
+		return InstallSnapshotResponse{Term: n.currentTerm}
+	}
+	if err := n.sm.restore(req.Data); err != nil {
+		slog.Error("failed to restore raft snapshot", "node", n.config.Id, "err", err)
+		return InstallSnapshotResponse{Term: n.currentTerm}
+	}
+	if req.LastIncludedIndex < n.lastIndex() && n.termAt(req.LastIncludedIndex) == req.LastIncludedTerm {
+		n.log = n.entriesFrom(req.LastIncludedIndex + 1)
+	} else {
+		n.log = nil
+	}
+	n.snapshotIndex = req.LastIncludedIndex
+	n.snapshotTerm = req.LastIncludedTerm
+	n.snapshotData = req.Data
+	n.commitIndex = max(n.commitIndex, req.LastIncludedIndex)
+	n.lastApplied = req.LastIncludedIndex
+	for index, waiter := range n.waiters {
+		if index <= n.lastApplied {
+			waiter.result <- ErrLeadershipLost
+			delete(n.waiters, index)
+		}
+	}
+	n.notifyChanged()
+	return InstallSnapshotResponse{Term: n.currentTerm}
+}
+
+func (n *raftNode) HandleForward(req ForwardRequest) ForwardResponse {
+	if req.ReadIndex {
+		index, err := n.readIndex()
+		return newForwardResponse(index, err)
+	}
+	return newForwardResponse(0, n.proposePrepared(req.Command))
+}
+
+func (n *raftNode) runApplier() {
+	defer n.wg.Done()
+	for {
+		n.mu.Lock()
+		if n.stopped {
+			n.mu.Unlock()
+			return
+		}
+		if n.lastApplied >= n.commitIndex {
+			changed := n.changed
+			n.mu.Unlock()
+			<-changed
+			continue
+		}
+		entries := cloneEntries(n.log[n.lastApplied-n.snapshotIndex : n.commitIndex-n.snapshotIndex])
+		n.mu.Unlock()
+		n.applyEntries(entries)
+	}
+}
+
+func (n *raftNode) applyEntries(entries []RaftEntry) {
+	n.applyMu.Lock()
+	defer n.applyMu.Unlock()
+	for _, entry := range entries {
+		n.mu.Lock()
+		// A snapshot may have been installed since the entries were read
+		if entry.Index != n.lastApplied+1 {
+			n.mu.Unlock()
+			return
+		}
+		n.mu.Unlock()
+
+		var err error
+		if entry.Command != nil {
+			err = n.sm.apply(entry.Command)
+		}
+
+		n.mu.Lock()
+		n.lastApplied = entry.Index
+		if waiter, ok := n.waiters[entry.Index]; ok {
+			if waiter.term != entry.Term {
+				err = ErrLeadershipLost
+			}
+			waiter.result <- err
+			delete(n.waiters, entry.Index)
+		}
+		n.notifyChanged()
+		n.mu.Unlock()
+	}
+	n.maybeSnapshot()
+}
+
+// maybeSnapshot compacts the log once enough entries have been applied. Requires applyMu.
+func (n *raftNode) maybeSnapshot() {
+	n.mu.Lock()
+	threshold := n.config.SnapshotThreshold
+	due := threshold > 0 && n.lastApplied-n.snapshotIndex >= threshold
+	index := n.lastApplied
+	n.mu.Unlock()
+	if !due {
+		return
+	}
+	data, err := n.sm.snapshot()
+	if err != nil {
+		slog.Error("failed to snapshot raft state", "node", n.config.Id, "err", err)
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	term := n.termAt(index)
+	n.log = n.entriesFrom(index + 1)
+	n.snapshotIndex = index
+	n.snapshotTerm = term
+	n.snapshotData = data
+}
+
+// propose appends a command to the leader's log and waits until it is applied,
+// returning the error from applying it to the state machine.
+func (n *raftNode) propose(command []byte) error {
+	n.mu.Lock()
+	if n.stopped {
+		n.mu.Unlock()
+		return ErrRaftStopped
+	}
+	if n.role != raftLeader {
+		n.mu.Unlock()
+		return ErrNotLeader
+	}
+	entry := RaftEntry{Term: n.currentTerm, Index: n.lastIndex() + 1, Command: command}
+	n.log = append(n.log, entry)
+	waiter := raftWaiter{term: entry.Term, result: make(chan error, 1)}
+	n.waiters[entry.Index] = waiter
+	n.advanceCommit()
+	n.broadcast()
+	n.mu.Unlock()
+
+	select {
+	case err := <-waiter.result:
+		return err
+	case <-time.After(n.config.RequestTimeout):
+		n.mu.Lock()
+		delete(n.waiters, entry.Index)
+		n.mu.Unlock()
+		return fmt.Errorf("%w: proposal %v", ErrRaftTimeout, entry.Index)
+	}
+}
+
+// proposePrepared waits for the leader to apply every entry in its log, has the state machine
+// prepare the command against that state and proposes the prepared command.
+func (n *raftNode) proposePrepared(command []byte) error {
+	n.prepareMu.Lock()
+	defer n.prepareMu.Unlock()
+	n.mu.Lock()
+	if n.role != raftLeader {
+		n.mu.Unlock()
+		return ErrNotLeader
+	}
+	last := n.lastIndex()
+	n.mu.Unlock()
+	if err := n.waitApplied(last); err != nil {
+		return err
+	}
+	command, err := n.sm.prepare(command)
+	if err != nil {
+		return err
+	}
+	return n.propose(command)
+}
+
+// readIndex confirms this node is still the leader and returns the commit index
+// a linearisable read must wait to be applied.
+func (n *raftNode) readIndex() (uint64, error) {
+	deadline := time.After(n.config.RequestTimeout)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	start := time.Now()
+	for {
+		if n.stopped {
+			return 0, ErrRaftStopped
+		}
+		if n.role != raftLeader {
+			return 0, ErrNotLeader
+		}
+		// The leader only knows the latest commit index once an entry from its term is committed
+		if n.termAt(n.commitIndex) == n.currentTerm {
+			acks := 1
+			for _, peer := range n.peers() {
+				if !n.lastAck[peer].Before(start) {
+					acks++
+				}
+			}
+			if acks >= n.quorum() {
+				return n.commitIndex, nil
+			}
+		}
+		changed := n.changed
+		n.mu.Unlock()
+		select {
+		case <-changed:
+		case <-deadline:
+			n.mu.Lock()
+			return 0, fmt.Errorf("%w: read index", ErrRaftTimeout)
+		}
+		n.mu.Lock()
+	}
+}
+
+// waitApplied blocks until the state machine has applied the given index.
+func (n *raftNode) waitApplied(index uint64) error {
+	deadline := time.After(n.config.RequestTimeout)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for n.lastApplied < index {
+		if n.stopped {
+			return ErrRaftStopped
+		}
+		changed := n.changed
+		n.mu.Unlock()
+		select {
+		case <-changed:
+		case <-deadline:
+			n.mu.Lock()
+			return fmt.Errorf("%w: waiting for index %v", ErrRaftTimeout, index)
+		}
+		n.mu.Lock()
+	}
+	return nil
+}
+
+// submit proposes a command on the leader, forwarding it when this node is a follower.
+// It retries while no leader is known or leadership moves, until the request timeout.
+func (n *raftNode) submit(command []byte) error {
+	return n.retry(func(leader string) error {
+		if leader == n.config.Id {
+			return n.proposePrepared(command)
+		}
+		resp, err := n.transport.Forward(leader, ForwardRequest{Command: command})
+		if err != nil {
+			return err
+		}
+		return resp.err()
+	})
+}
+
+// readBarrier waits until this node has applied every entry committed before the call,
+// making a following local read linearisable.
+func (n *raftNode) readBarrier() error {
+	var index uint64
+	err := n.retry(func(leader string) error {
+		if leader == n.config.Id {
+			i, err := n.readIndex()
+			index = i
+			return err
+		}
+		resp, err := n.transport.Forward(leader, ForwardRequest{ReadIndex: true})
+		if err != nil {
+			return err
+		}
+		index = resp.Index
+		return resp.err()
+	})
+	if err != nil {
+		return err
+	}
+	return n.waitApplied(index)
+}
+
+func (n *raftNode) retry(fn func(leader string) error) error {
+	deadline := time.Now().Add(n.config.RequestTimeout)
+	for {
+		_, _, leader := n.status()
+		err := ErrNotLeader
+		if leader != "" {
+			err = fn(leader)
+		}
+		retryable := errors.Is(err, ErrNotLeader) || errors.Is(err, ErrNodeUnreachable)
+		if !retryable {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %w", ErrRaftTimeout, err)
+		}
+		select {
+		case <-n.stopCh:
+			return ErrRaftStopped
+		case <-time.After(n.config.HeartbeatInterval):
+		}
+	}
+}
+
+// forwardErrorCodes lets sentinel errors survive being forwarded between nodes.
+var forwardErrorCodes = map[string]error{
+	"concurrency_conflict": ErrConcurrencyConflict,
+	"not_leader":           ErrNotLeader,
+	"leadership_lost":      ErrLeadershipLost,
+	"timeout":              ErrRaftTimeout,
+	"stopped":              ErrRaftStopped,
+}
+
+func newForwardResponse(index uint64, err error) ForwardResponse {
+	resp := ForwardResponse{Index: index}
+	if err == nil {
+		return resp
+	}
+	resp.Error = err.Error()
+	for code, sentinel := range forwardErrorCodes {
+		if errors.Is(err, sentinel) {
+			resp.ErrorCode = code
+		}
+	}
+	return resp
+}
+
+func (r ForwardResponse) err() error {
+	if r.Error == "" {
+		return nil
+	}
+	if sentinel, ok := forwardErrorCodes[r.ErrorCode]; ok {
+		return fmt.Errorf("%w: %v", sentinel, r.Error)
+	}
+	return errors.New(r.Error)
+}
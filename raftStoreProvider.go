@@ -0,0 +1,466 @@
+package moments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+type raftCommandType string
+
+const (
+	raftNewTenant      raftCommandType = "new_tenant"
+	raftDeleteTenant   raftCommandType = "delete_tenant"
+	raftSaveEvents     raftCommandType = "save_events"
+	raftSaveSnapshot   raftCommandType = "save_snapshot"
+	raftDeleteSnapshot raftCommandType = "delete_snapshot"
+	raftImportEvents   raftCommandType = "import_events"
+)
+
+// raftCommand is a store operation written to the raft log.
+type raftCommand struct {
+	Type            raftCommandType
+	Tenant          TenantId
+	StreamId        StreamId      `json:",omitzero"`
+	Events          []raftEvent   `json:",omitempty"`
+	CorrelationId   CorrelationId `json:",omitempty"`
+	CausationId     CausationId   `json:",omitempty"`
+	Metadata        Metadata      `json:",omitempty"`
+	ExpectedVersion Version       `json:",omitempty"`
+	Snapshot        *Snapshot     `json:",omitempty"`
+	SnapshotId      SnapshotId    `json:",omitzero"`
+	// Imported holds events imported with their serialised payload in place of their data
+	Imported []PersistedEvent `json:",omitempty"`
+}
+
+type raftEvent struct {
+	EventId     EventId
+	EventType   EventType
+	ContentType string
+	Data        []byte
+	Timestamp   time.Time
+	CausationId CausationId `json:",omitempty"`
+	Metadata    Metadata    `json:",omitempty"`
+}
+
+// RaftStoreProvider is a StoreProvider replicated across a raft cluster. Every write is
+// ordered by the raft log and applied to the local provider of each node, so the nodes'
+// local stores hold identical events and sequences. Writes made on a follower are forwarded
+// to the leader. Reads are served by the local provider.
+//
+// The leader serialises, hashes and signs the events of each save once and replicates the
+// finished events, so every node holds the same data, hashes and signatures. The stores of
+// the local provider must implement EventImporter. PayloadCodecs run on each node as it
+// stores the events.
+//
+// ReplicationFeed, and the EventImporter, SnapshotLister and ChainVerifier of its stores, are
+// forwarded to the local provider, so tenants can be exported, imported, backed up and restored
+// when the local provider supports them. Imports are replicated like any other write.
+//
+// Save middleware runs once, in the session the events are saved through.
+type RaftStoreProvider struct {
+	local  StoreProvider
+	config *Config
+	node   *raftNode
+}
+
+// NewRaftStoreProvider starts a raft node replicating writes into the local provider.
+// The local provider must implement StoreProviderSnapshotter when the raft config
+// enables snapshots.
+func NewRaftStoreProvider(
+	local StoreProvider, config *Config, raftConfig RaftConfig, transport RaftTransport,
+) (*RaftStoreProvider, error) {
+	if !slices.Contains(raftConfig.Peers, raftConfig.Id) {
+		return nil, fmt.Errorf("raft node %v is not one of its peers %v", raftConfig.Id, raftConfig.Peers)
+	}
+	if _, ok := local.(StoreProviderSnapshotter); raftConfig.SnapshotThreshold > 0 && !ok {
+		return nil, errors.New("raft snapshots require the local store provider to implement StoreProviderSnapshotter")
+	}
+	p := &RaftStoreProvider{local: local, config: config}
+	p.node = newRaftNode(raftConfig, transport, p)
+	p.node.start()
+	return p, nil
+}
+
+// IsLeader reports whether this node currently leads the cluster.
+func (p *RaftStoreProvider) IsLeader() bool {
+	role, _, _ := p.node.status()
+	return role == raftLeader
+}
+
+// Leader returns the id of the node this node believes is leading, or "" when unknown.
+func (p *RaftStoreProvider) Leader() string {
+	_, _, leader := p.node.status()
+	return leader
+}
+
+func (p *RaftStoreProvider) NewTenant(tenant TenantId) error {
+	return p.submit(raftCommand{Type: raftNewTenant, Tenant: tenant})
+}
+
+func (p *RaftStoreProvider) DeleteTenant(tenant TenantId) error {
+	return p.submit(raftCommand{Type: raftDeleteTenant, Tenant: tenant})
+}
+
+func (p *RaftStoreProvider) TenantExists(tenant TenantId) (bool, error) {
+	if err := p.readBarrier(); err != nil {
+		return false, err
+	}
+	return p.local.TenantExists(tenant)
+}
+
+func (p *RaftStoreProvider) NewStore(tenant TenantId) (Store, error) {
+	exists, err := p.TenantExists(tenant)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.New(fmt.Sprintln("Tenant doesnt exist", tenant))
+	}
+	return &raftStore{provider: p, tenant: tenant}, nil
+}
+
+// Close stops the raft node and closes the local provider.
+func (p *RaftStoreProvider) Close() {
+	p.node.stop()
+	p.local.Close()
+}
+
+func (p *RaftStoreProvider) submit(command raftCommand) error {
+	data, err := json.Marshal(command)
+	if err != nil {
+		return err
+	}
+	return p.node.submit(data)
+}
+
+func (p *RaftStoreProvider) readBarrier() error {
+	if !p.node.config.LinearisableReads {
+		return nil
+	}
+	return p.node.readBarrier()
+}
+
+// localStore opens the tenant's store on the local provider. It is opened per operation
+// so stores always see state restored from a raft snapshot.
+func (p *RaftStoreProvider) localStore(tenant TenantId) (Store, error) {
+	return p.local.NewStore(tenant)
+}
+
+func (p *RaftStoreProvider) apply(data []byte) error {
+	var command raftCommand
+	if err := json.Unmarshal(data, &command); err != nil {
+		return err
+	}
+	switch command.Type {
+	case raftNewTenant:
+		return p.local.NewTenant(command.Tenant)
+	case raftDeleteTenant:
+		return p.local.DeleteTenant(command.Tenant)
+	}
+
+	store, err := p.localStore(command.Tenant)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	switch command.Type {
+	case raftSaveSnapshot:
+		return store.SaveSnapshot(command.Snapshot)
+	case raftDeleteSnapshot:
+		return store.DeleteSnapshot(command.SnapshotId)
+	case raftImportEvents:
+		importer, ok := store.(EventImporter)
+		if !ok {
+			return errUnsupported(store, "EventImporter")
+		}
+		for i := range command.Imported {
+			evt := &command.Imported[i]
+			if evt.Data, err = p.config.unmarshalEvent(evt.EventType, evt.ContentType, evt.Payload); err != nil {
+				return err
+			}
+		}
+		if err := importer.ImportEvents(command.Imported); err != nil || command.Snapshot == nil {
+			return err
+		}
+		return store.SaveSnapshot(command.Snapshot)
+	default:
+		return fmt.Errorf("unknown raft command %v", command.Type)
+	}
+}
+
+// prepare turns a save into the import of the events it persists. The events are built once,
+// on the leader, so every node stores the same serialised data, hashes and signatures.
+// Other commands are appended as they are.
+func (p *RaftStoreProvider) prepare(data []byte) ([]byte, error) {
+	var command raftCommand
+	if err := json.Unmarshal(data, &command); err != nil {
+		return nil, err
+	}
+	if command.Type != raftSaveEvents {
+		return data, nil
+	}
+	args, err := p.saveEventArgs(command)
+	if err != nil {
+		return nil, err
+	}
+	store, err := p.localStore(command.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	head, err := storeHead(store, args.StreamId)
+	if err != nil {
+		return nil, err
+	}
+	events, err := p.config.persistEvents(args, head)
+	if err != nil {
+		return nil, err
+	}
+	for i := range events {
+		events[i].Data = nil
+	}
+	return json.Marshal(raftCommand{
+		Type:     raftImportEvents,
+		Tenant:   command.Tenant,
+		Imported: events,
+		Snapshot: command.Snapshot,
+	})
+}
+
+// storeHead reads the position a save to the stream is appended at from the store's latest events.
+func storeHead(store Store, streamId StreamId) (eventLogHead, error) {
+	var head eventLogHead
+	events, err := store.LoadEvents(LoadEventArgs{StreamId: streamId, Descending: true, Count: 1})
+	if err != nil {
+		return head, err
+	}
+	if len(events) > 0 {
+		head.version, head.streamHash = events[0].Version, events[0].Hash
+	}
+	if events, err = store.LoadEvents(LoadEventArgs{Descending: true, Count: 1}); err != nil {
+		return head, err
+	}
+	if len(events) > 0 {
+		head.sequence, head.logHash = events[0].GlobalSequence, events[0].Hash
+	}
+	return head, nil
+}
+
+func (p *RaftStoreProvider) saveEventArgs(command raftCommand) (SaveEventArgs, error) {
+	events := make([]Event, len(command.Events))
+	for i, evt := range command.Events {
+		data, err := p.config.unmarshalEvent(evt.EventType, evt.ContentType, evt.Data)
+		if err != nil {
+			return SaveEventArgs{}, err
+		}
+		events[i] = Event{
+			EventId:     evt.EventId,
+			Data:        data,
+			Timestamp:   evt.Timestamp,
+			CausationId: evt.CausationId,
+			Metadata:    evt.Metadata,
+		}
+	}
+	return SaveEventArgs{
+		Context:         context.Background(),
+		StreamId:        command.StreamId,
+		Events:          events,
+		CorrelationId:   command.CorrelationId,
+		CausationId:     command.CausationId,
+		Metadata:        command.Metadata,
+		ExpectedVersion: command.ExpectedVersion,
+		Snapshot:        command.Snapshot,
+	}, nil
+}
+
+func (p *RaftStoreProvider) Tenants() ([]TenantId, error) {
+	feed, ok := p.local.(ReplicationFeed)
+	if !ok {
+		return nil, errUnsupported(p.local, "ReplicationFeed")
+	}
+	if err := p.readBarrier(); err != nil {
+		return nil, err
+	}
+	return feed.Tenants()
+}
+
+func (p *RaftStoreProvider) ReadFeed(tenant TenantId, after Sequence, count uint) ([]PersistedEvent, error) {
+	feed, ok := p.local.(ReplicationFeed)
+	if !ok {
+		return nil, errUnsupported(p.local, "ReplicationFeed")
+	}
+	if err := p.readBarrier(); err != nil {
+		return nil, err
+	}
+	return feed.ReadFeed(tenant, after, count)
+}
+
+func (p *RaftStoreProvider) HeadSequence(tenant TenantId) (Sequence, error) {
+	feed, ok := p.local.(ReplicationFeed)
+	if !ok {
+		return 0, errUnsupported(p.local, "ReplicationFeed")
+	}
+	if err := p.readBarrier(); err != nil {
+		return 0, err
+	}
+	return feed.HeadSequence(tenant)
+}
+
+func (p *RaftStoreProvider) snapshot() ([]byte, error) {
+	return p.local.(StoreProviderSnapshotter).SnapshotState()
+}
+
+func (p *RaftStoreProvider) restore(data []byte) error {
+	return p.local.(StoreProviderSnapshotter).RestoreState(data)
+}
+
+type raftStore struct {
+	provider *RaftStoreProvider
+	tenant   TenantId
+}
+
+func (s *raftStore) Close() {
+}
+
+// SaveEvents replicates the events and returns once they are applied on the leader.
+// Events without a timestamp are stamped before replication so every node stores the same time.
+// The leader persists the events, replicating them as an import of the finished events.
+func (s *raftStore) SaveEvents(args SaveEventArgs) error {
+	events := make([]raftEvent, len(args.Events))
+	for i, evt := range args.Events {
+		eventType, err := GetEventType(evt.Data)
+		if err != nil {
+			return err
+		}
+		serialiser := s.provider.config.eventSerialiser(*eventType)
+		data, err := serialiser.Marshal(evt.Data)
+		if err != nil {
+			return err
+		}
+		timestamp := evt.Timestamp
+		if timestamp.IsZero() {
+			timestamp = s.provider.config.now()
+		}
+		events[i] = raftEvent{
+			EventId:     evt.EventId,
+			EventType:   *eventType,
+			ContentType: serialiser.ContentType,
+			Data:        data,
+			Timestamp:   timestamp,
+			CausationId: evt.CausationId,
+			Metadata:    evt.Metadata,
+		}
+	}
+	return s.provider.submit(raftCommand{
+		Type:            raftSaveEvents,
+		Tenant:          s.tenant,
+		StreamId:        args.StreamId,
+		Events:          events,
+		CorrelationId:   args.CorrelationId,
+		CausationId:     args.CausationId,
+		Metadata:        args.Metadata,
+		ExpectedVersion: args.ExpectedVersion,
+		Snapshot:        args.Snapshot,
+	})
+}
+
+func (s *raftStore) LoadEvents(options LoadEventArgs) ([]PersistedEvent, error) {
+	if err := s.provider.readBarrier(); err != nil {
+		return nil, err
+	}
+	store, err := s.provider.localStore(s.tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	return store.LoadEvents(options)
+}
+
+func (s *raftStore) SaveSnapshot(snapshot *Snapshot) error {
+	return s.provider.submit(raftCommand{Type: raftSaveSnapshot, Tenant: s.tenant, Snapshot: snapshot})
+}
+
+func (s *raftStore) LoadSnapshot(id SnapshotId) (*Snapshot, error) {
+	if err := s.provider.readBarrier(); err != nil {
+		return nil, err
+	}
+	store, err := s.provider.localStore(s.tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	return store.LoadSnapshot(id)
+}
+
+func (s *raftStore) DeleteSnapshot(id SnapshotId) error {
+	return s.provider.submit(raftCommand{Type: raftDeleteSnapshot, Tenant: s.tenant, SnapshotId: id})
+}
+
+// ImportEvents replicates the events with their serialised payload so every node stores,
+// and hashes, the same bytes.
+func (s *raftStore) ImportEvents(events []PersistedEvent) error {
+	imported := make([]PersistedEvent, len(events))
+	for i, evt := range events {
+		if evt.Payload == nil {
+			payload, err := s.provider.config.marshalEvent(&evt)
+			if err != nil {
+				return err
+			}
+			evt.Payload = payload
+		}
+		evt.Data = nil
+		imported[i] = evt
+	}
+	return s.provider.submit(raftCommand{Type: raftImportEvents, Tenant: s.tenant, Imported: imported})
+}
+
+func (s *raftStore) Snapshots() ([]Snapshot, error) {
+	store, err := s.readStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	lister, ok := store.(SnapshotLister)
+	if !ok {
+		return nil, errUnsupported(store, "SnapshotLister")
+	}
+	return lister.Snapshots()
+}
+
+func (s *raftStore) VerifyStream(streamId StreamId) (*BrokenLink, error) {
+	store, err := s.readStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	verifier, ok := store.(ChainVerifier)
+	if !ok {
+		return nil, errUnsupported(store, "ChainVerifier")
+	}
+	return verifier.VerifyStream(streamId)
+}
+
+func (s *raftStore) VerifyLog() (*BrokenLink, error) {
+	store, err := s.readStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	verifier, ok := store.(ChainVerifier)
+	if !ok {
+		return nil, errUnsupported(store, "ChainVerifier")
+	}
+	return verifier.VerifyLog()
+}
+
+// readStore returns the tenant's local store once the node has applied every committed write.
+func (s *raftStore) readStore() (Store, error) {
+	if err := s.provider.readBarrier(); err != nil {
+		return nil, err
+	}
+	return s.provider.localStore(s.tenant)
+}
@@ -0,0 +1,182 @@
+package moments
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type (
+	// RaftEntry is a replicated log entry. A nil Command is a no-op written by new leaders.
+	RaftEntry struct {
+		Term    uint64
+		Index   uint64
+		Command []byte
+	}
+
+	RequestVoteRequest struct {
+		Term         uint64
+		CandidateId  string
+		LastLogIndex uint64
+		LastLogTerm  uint64
+	}
+	RequestVoteResponse struct {
+		Term        uint64
+		VoteGranted bool
+	}
+
+	AppendEntriesRequest struct {
+		Term         uint64
+		LeaderId     string
+		PrevLogIndex uint64
+		PrevLogTerm  uint64
+		Entries      []RaftEntry
+		LeaderCommit uint64
+	}
+	AppendEntriesResponse struct {
+		Term    uint64
+		Success bool
+		// LastLogIndex is the follower's last log index, used by the leader to back up quickly
+		LastLogIndex uint64
+	}
+
+	InstallSnapshotRequest struct {
+		Term              uint64
+		LeaderId          string
+		LastIncludedIndex uint64
+		LastIncludedTerm  uint64
+		Data              []byte
+	}
+	InstallSnapshotResponse struct {
+		Term uint64
+	}
+
+	// ForwardRequest is sent by followers to the leader to propose a command,
+	// or to obtain a read index for a linearisable read.
+	ForwardRequest struct {
+		Command   []byte
+		ReadIndex bool
+	}
+	ForwardResponse struct {
+		Index     uint64
+		Error     string
+		ErrorCode string
+	}
+)
+
+// RaftHandler serves the RPCs addressed to a raft node.
+type RaftHandler interface {
+	HandleRequestVote(req RequestVoteRequest) RequestVoteResponse
+	HandleAppendEntries(req AppendEntriesRequest) AppendEntriesResponse
+	HandleInstallSnapshot(req InstallSnapshotRequest) InstallSnapshotResponse
+	HandleForward(req ForwardRequest) ForwardResponse
+}
+
+// RaftTransport carries RPCs between the nodes of a raft cluster on behalf of a single node.
+type RaftTransport interface {
+	// Listen registers the handler serving RPCs addressed to this node.
+	Listen(handler RaftHandler)
+	RequestVote(target string, req RequestVoteRequest) (RequestVoteResponse, error)
+	AppendEntries(target string, req AppendEntriesRequest) (AppendEntriesResponse, error)
+	InstallSnapshot(target string, req InstallSnapshotRequest) (InstallSnapshotResponse, error)
+	Forward(target string, req ForwardRequest) (ForwardResponse, error)
+}
+
+var ErrNodeUnreachable = errors.New("node unreachable")
+
+// InProcessNetwork connects raft nodes running in the same process.
+// Nodes can be disconnected to simulate failures and partitions.
+type InProcessNetwork struct {
+	mu           sync.RWMutex
+	handlers     map[string]RaftHandler
+	disconnected map[string]bool
+}
+
+func NewInProcessNetwork() *InProcessNetwork {
+	return &InProcessNetwork{
+		handlers:     map[string]RaftHandler{},
+		disconnected: map[string]bool{},
+	}
+}
+
+// Transport returns the transport used by the node with the given id.
+func (n *InProcessNetwork) Transport(id string) RaftTransport {
+	return &inProcessTransport{network: n, id: id}
+}
+
+// Disconnect drops all RPCs to and from the node until it is reconnected.
+func (n *InProcessNetwork) Disconnect(id string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.disconnected[id] = true
+}
+
+func (n *InProcessNetwork) Reconnect(id string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.disconnected, id)
+}
+
+func (n *InProcessNetwork) handler(from string, to string) (RaftHandler, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	handler, ok := n.handlers[to]
+	if !ok || n.disconnected[from] || n.disconnected[to] {
+		return nil, fmt.Errorf("%w: %v", ErrNodeUnreachable, to)
+	}
+	return handler, nil
+}
+
+type inProcessTransport struct {
+	network *InProcessNetwork
+	id      string
+}
+
+func (t *inProcessTransport) Listen(handler RaftHandler) {
+	t.network.mu.Lock()
+	defer t.network.mu.Unlock()
+	t.network.handlers[t.id] = handler
+}
+
+func (t *inProcessTransport) RequestVote(target string, req RequestVoteRequest) (RequestVoteResponse, error) {
+	handler, err := t.network.handler(t.id, target)
+	if err != nil {
+		return RequestVoteResponse{}, err
+	}
+	return handler.HandleRequestVote(req), nil
+}
+
+func (t *inProcessTransport) AppendEntries(target string, req AppendEntriesRequest) (AppendEntriesResponse, error) {
+	handler, err := t.network.handler(t.id, target)
+	if err != nil {
+		return AppendEntriesResponse{}, err
+	}
+	// Entries are shared with the sender's log so hand the receiver its own copy
+	req.Entries = cloneEntries(req.Entries)
+	return handler.HandleAppendEntries(req), nil
+}
+
+func (t *inProcessTransport) InstallSnapshot(target string, req InstallSnapshotRequest) (InstallSnapshotResponse, error) {
+	handler, err := t.network.handler(t.id, target)
+	if err != nil {
+		return InstallSnapshotResponse{}, err
+	}
+	return handler.HandleInstallSnapshot(req), nil
+}
+
+func (t *inProcessTransport) Forward(target string, req ForwardRequest) (ForwardResponse, error) {
+	handler, err := t.network.handler(t.id, target)
+	if err != nil {
+		return ForwardResponse{}, err
+	}
+	return handler.HandleForward(req), nil
+}
+
+func cloneEntries(entries []RaftEntry) []RaftEntry {
+	return mapSlice(entries, func(e RaftEntry) RaftEntry {
+		if e.Command != nil {
+			e.Command = append([]byte(nil), e.Command...)
+		}
+		return e
+	})
+}
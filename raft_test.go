@@ -0,0 +1,403 @@
+package moments
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type raftCluster struct {
+	t         *testing.T
+	network   *InProcessNetwork
+	config    *Config
+	ids       []string
+	providers map[string]*RaftStoreProvider
+}
+
+func newRaftCluster(t *testing.T, size int, raftConfig RaftConfig) *raftCluster {
+	config := &Config{
+		Aggregates: map[AggregateType]AggregateConfig{
+			"Calculator": {StoreStrategy: alwaysSnapshot},
+		},
+		EventDeserialiser:  createEventDeserialiser(),
+		SnapshotSerialiser: &JsonSnapshotSerialiser,
+	}
+	c := &raftCluster{
+		t:         t,
+		network:   NewInProcessNetwork(),
+		config:    config,
+		providers: map[string]*RaftStoreProvider{},
+	}
+	for i := range size {
+		c.ids = append(c.ids, fmt.Sprintf("node%v", i+1))
+	}
+	for _, id := range c.ids {
+		nodeConfig := raftConfig
+		nodeConfig.Id = id
+		nodeConfig.Peers = c.ids
+		nodeConfig.ElectionTimeout = 100 * time.Millisecond
+		nodeConfig.HeartbeatInterval = 20 * time.Millisecond
+		nodeConfig.RequestTimeout = time.Second
+		provider, err := NewRaftStoreProvider(
+			NewMemoryStoreProvider(config), config, nodeConfig, c.network.Transport(id))
+		require.NoError(t, err)
+		c.providers[id] = provider
+	}
+	t.Cleanup(func() {
+		for _, provider := range c.providers {
+			provider.Close()
+		}
+	})
+	return c
+}
+
+// leader waits for a single connected node to lead the cluster.
+func (c *raftCluster) leader(except ...string) string {
+	var leader string
+	require.Eventually(c.t, func() bool {
+		leaders := 0
+		for id, provider := range c.providers {
+			if provider.IsLeader() && !slices.Contains(except, id) {
+				leader = id
+				leaders++
+			}
+		}
+		return leaders == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	return leader
+}
+
+func (c *raftCluster) follower(leader string) string {
+	for _, id := range c.ids {
+		if id != leader {
+			return id
+		}
+	}
+	panic("cluster has no followers")
+}
+
+func (c *raftCluster) session(id string) *Session {
+	session, err := c.newSession(id)
+	require.NoError(c.t, err)
+	return session
+}
+
+func (c *raftCluster) newSession(id string) (*Session, error) {
+	sessionProvider, err := NewSessionProvider(c.providers[id], *c.config)
+	if err != nil {
+		return nil, err
+	}
+	return sessionProvider.NewSession("default")
+}
+
+// waitForValue waits for the calculator to reach the value when read from the node's local store.
+func (c *raftCluster) waitForValue(id string, calcId string, value int) {
+	require.Eventually(c.t, func() bool {
+		session, err := c.newSession(id)
+		if err != nil {
+			return false
+		}
+		calc := newCalculator(calcId)
+		if err := session.LoadAggregate(calc); err != nil {
+			return false
+		}
+		return calc.State().Value == value
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRaftElectsSingleLeader(t *testing.T) {
+	cluster := newRaftCluster(t, 3, RaftConfig{})
+	leader := cluster.leader()
+	for _, id := range cluster.ids {
+		assert.Eventually(t, func() bool {
+			return cluster.providers[id].Leader() == leader
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+}
+
+func TestRaftReplicatesWritesToEveryNode(t *testing.T) {
+	cluster := newRaftCluster(t, 3, RaftConfig{})
+	leader := cluster.leader()
+	require.NoError(t, cluster.providers[leader].NewTenant("default"))
+
+	session := cluster.session(leader)
+	calc := newCalculator("c1")
+	calc.update(5)
+	calc.add(2)
+	require.NoError(t, session.Save(calc))
+
+	for _, id := range cluster.ids {
+		cluster.waitForValue(id, "c1", 7)
+		events, err := cluster.session(id).LoadStream(calc.StreamId())
+		require.NoError(t, err)
+		assert.Equal(t, []Sequence{1, 2}, mapSlice(events, func(e PersistedEvent) Sequence { return e.Sequence }))
+	}
+}
+
+func TestRaftForwardsWritesFromFollowers(t *testing.T) {
+	cluster := newRaftCluster(t, 3, RaftConfig{LinearisableReads: true})
+	leader := cluster.leader()
+	follower := cluster.follower(leader)
+	require.NoError(t, cluster.providers[follower].NewTenant("default"))
+
+	session := cluster.session(follower)
+	calc := newCalculator("c1")
+	calc.update(3)
+	require.NoError(t, session.Save(calc))
+
+	// Linearisable reads observe the write on every node without waiting
+	for _, id := range cluster.ids {
+		loaded := newCalculator("c1")
+		require.NoError(t, cluster.session(id).LoadAggregate(loaded))
+		assert.Equal(t, 3, loaded.State().Value)
+	}
+}
+
+func TestRaftForwardsConcurrencyConflicts(t *testing.T) {
+	cluster := newRaftCluster(t, 3, RaftConfig{LinearisableReads: true})
+	leader := cluster.leader()
+	follower := cluster.follower(leader)
+	require.NoError(t, cluster.providers[leader].NewTenant("default"))
+
+	first := newCalculator("c1")
+	first.update(1)
+	require.NoError(t, cluster.session(leader).Save(first))
+
+	stale := newCalculator("c1")
+	stale.update(2)
+	err := cluster.session(follower).Save(stale)
+	assert.ErrorIs(t, err, ErrConcurrencyConflict)
+}
+
+func TestRaftElectsNewLeaderWhenLeaderIsDisconnected(t *testing.T) {
+	cluster := newRaftCluster(t, 3, RaftConfig{LinearisableReads: true})
+	oldLeader := cluster.leader()
+	require.NoError(t, cluster.providers[oldLeader].NewTenant("default"))
+	calc := newCalculator("c1")
+	calc.update(1)
+	require.NoError(t, cluster.session(oldLeader).Save(calc))
+
+	cluster.network.Disconnect(oldLeader)
+	newLeader := cluster.leader(oldLeader)
+	assert.NotEqual(t, oldLeader, newLeader)
+
+	session := cluster.session(newLeader)
+	loaded := newCalculator("c1")
+	require.NoError(t, session.LoadAggregate(loaded))
+	loaded.add(4)
+	require.NoError(t, session.Save(loaded))
+
+	// The old leader cannot serve linearisable reads while partitioned
+	_, err := cluster.providers[oldLeader].TenantExists("default")
+	assert.Error(t, err)
+
+	cluster.network.Reconnect(oldLeader)
+	cluster.waitForValue(oldLeader, "c1", 5)
+	assert.False(t, cluster.providers[oldLeader].IsLeader())
+}
+
+func TestRaftCatchesUpLaggingNodeFromSnapshot(t *testing.T) {
+	cluster := newRaftCluster(t, 3, RaftConfig{SnapshotThreshold: 5})
+	leader := cluster.leader()
+	lagging := cluster.follower(leader)
+	require.NoError(t, cluster.providers[leader].NewTenant("default"))
+
+	cluster.network.Disconnect(lagging)
+	session := cluster.session(leader)
+	for range 20 {
+		calc := newCalculator("c1")
+		require.NoError(t, session.LoadAggregate(calc))
+		calc.add(1)
+		require.NoError(t, session.Save(calc))
+	}
+	leaderNode := cluster.providers[leader].node
+	leaderNode.mu.Lock()
+	snapshotIndex := leaderNode.snapshotIndex
+	leaderNode.mu.Unlock()
+	assert.Greater(t, snapshotIndex, uint64(0))
+
+	// Let the lagging node campaign in later terms while it is cut off
+	time.Sleep(500 * time.Millisecond)
+	cluster.network.Reconnect(lagging)
+	cluster.waitForValue(lagging, "c1", 20)
+	events, err := cluster.session(lagging).LoadStream(newCalculator("c1").StreamId())
+	require.NoError(t, err)
+	assert.Len(t, events, 20)
+}
+
+func TestRaftRequiresSnapshotterForSnapshots(t *testing.T) {
+	config := &Config{}
+	local := NewInstrumentedStoreProvider(NewMemoryStoreProvider(config), InstrumentationOptions{})
+	_, err := NewRaftStoreProvider(local, config,
+		RaftConfig{Id: "node1", Peers: []string{"node1"}, SnapshotThreshold: 10},
+		NewInProcessNetwork().Transport("node1"))
+	assert.Error(t, err)
+}
+
+func TestMemoryStoreProviderSnapshotRestore(t *testing.T) {
+	config := &Config{
+		Aggregates: map[AggregateType]AggregateConfig{
+			"Calculator": {StoreStrategy: alwaysSnapshot},
+		},
+		EventDeserialiser: createEventDeserialiser(),
+	}
+	provider := NewMemoryStoreProvider(config)
+	require.NoError(t, provider.NewTenant("default"))
+	sessionProvider, err := NewSessionProvider(provider, *config)
+	require.NoError(t, err)
+	session, err := sessionProvider.NewSession("default")
+	require.NoError(t, err)
+	calc := newCalculator("c1")
+	calc.update(5)
+	calc.add(2)
+	require.NoError(t, session.Save(calc))
+
+	data, err := provider.SnapshotState()
+	require.NoError(t, err)
+
+	restored := NewMemoryStoreProvider(config)
+	require.NoError(t, restored.NewTenant("stale"))
+	require.NoError(t, restored.RestoreState(data))
+	exists, _ := restored.TenantExists("stale")
+	assert.False(t, exists)
+
+	store, err := restored.NewStore("default")
+	require.NoError(t, err)
+	events, err := store.LoadEvents(LoadEventArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, []any{calculator_updated_v1{Value: 5}, calculator_added_v1{Value: 2}},
+		mapSlice(events, func(e PersistedEvent) any { return e.Data }))
+	snapshot, err := store.LoadSnapshot(NewSnapshotId(calc.StreamId(), calc.SchemaVersion()))
+	require.NoError(t, err)
+	assert.Equal(t, Version(2), snapshot.Version)
+}
+
+func TestRaftStaleAppendEntriesDoesNotLowerCommitIndex(t *testing.T) {
+	node := newRaftNode(RaftConfig{Id: "n1", Peers: []string{"n2"}}, NewInProcessNetwork().Transport("n1"), nil)
+	entries := []RaftEntry{{Index: 1, Term: 1}, {Index: 2, Term: 1}, {Index: 3, Term: 1}, {Index: 4, Term: 1}}
+
+	resp := node.HandleAppendEntries(AppendEntriesRequest{Term: 1, LeaderId: "n2", Entries: entries, LeaderCommit: 3})
+	require.True(t, resp.Success)
+	assert.Equal(t, uint64(3), node.commitIndex)
+
+	// A delayed retry holding only the first entry arrives after the leader has committed more
+	resp = node.HandleAppendEntries(AppendEntriesRequest{Term: 1, LeaderId: "n2", Entries: entries[:1], LeaderCommit: 4})
+	require.True(t, resp.Success)
+	assert.Equal(t, uint64(3), node.commitIndex)
+	assert.Equal(t, uint64(4), node.lastIndex())
+}
+
+func TestRaftImportsTenantOnEveryNode(t *testing.T) {
+	cluster := newRaftCluster(t, 3, RaftConfig{LinearisableReads: true})
+	leader := cluster.leader()
+	source := NewMemoryStoreProvider(cluster.config)
+	require.NoError(t, source.NewTenant("default"))
+	saveCalculators(t, exportSession(t, source, cluster.config, "default"))
+	var buf bytes.Buffer
+	exported, err := ExportTenant(&buf, source, cluster.config, "default")
+	require.NoError(t, err)
+
+	imported, err := ImportTenant(&buf, cluster.providers[cluster.follower(leader)], cluster.config, "")
+	require.NoError(t, err)
+	assert.Equal(t, exported, imported)
+
+	want, err := source.ReadFeed("default", 0, 0)
+	require.NoError(t, err)
+	for _, id := range cluster.ids {
+		got, err := cluster.providers[id].ReadFeed("default", 0, 0)
+		require.NoError(t, err)
+		// Timestamps lose their location through the raft log, the hashes cover their instant
+		hashes := func(e PersistedEvent) string { return e.Hash }
+		assert.Equal(t, mapSlice(want, hashes), mapSlice(got, hashes))
+		loaded := newCalculator("c1")
+		require.NoError(t, cluster.session(id).LoadAggregate(loaded))
+		assert.Equal(t, 6, loaded.State().Value)
+	}
+}
+
+func TestRaftNodesStoreIdenticalEvents(t *testing.T) {
+	cluster := newRaftCluster(t, 3, RaftConfig{LinearisableReads: true})
+	// Encrypting personal data uses a random nonce and gob encodes maps in random order,
+	// so persisting the events on each node would store different bytes and hashes
+	shredder := NewCryptoShredder(NewMemoryKeyStore())
+	cluster.config.SaveMiddleware = []EventMiddleware{shredder.SaveMiddleware()}
+	cluster.config.LoadMiddleware = []EventMiddleware{shredder.LoadMiddleware()}
+	cluster.config.DefaultEventSerialiser = &GobEventSerialiser
+	require.NoError(t, AddJsonEventDeserialiser[customer_registered_v1](*cluster.config.EventDeserialiser))
+	require.NoError(t, AddJsonEventDeserialiser[calculator_tagged_v1](*cluster.config.EventDeserialiser))
+	leader := cluster.leader()
+	require.NoError(t, cluster.providers[leader].NewTenant("default"))
+
+	registered := customer_registered_v1{CustomerId: "c1", Name: "Alice", Plan: "pro"}
+	saveCustomerEvents(t, cluster.session(cluster.follower(leader)), "c1", registered)
+	tags := map[string]int{}
+	for i := range 20 {
+		tags[fmt.Sprint("tag", i)] = i
+	}
+	session := cluster.session(leader)
+	require.NoError(t, session.saveEvents(session.Context, StreamId{Id: "t1", StreamType: calculatorType},
+		[]Event{NewEvent(calculator_tagged_v1{Tags: tags}, nil)}, 1))
+
+	var hashes [][]string
+	var data [][][]byte
+	for _, id := range cluster.ids {
+		events, err := cluster.providers[id].ReadFeed("default", 0, 0)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		hashes = append(hashes, mapSlice(events, func(e PersistedEvent) string { return e.Hash }))
+		state, err := cluster.providers[id].local.(*MemoryStoreProvider).tenantState("default")
+		require.NoError(t, err)
+		data = append(data, [][]byte{state.eventData[1], state.eventData[2]})
+
+		loaded, err := cluster.session(id).LoadEvents(LoadEventArgs{})
+		require.NoError(t, err)
+		assert.Equal(t, []any{registered, calculator_tagged_v1{Tags: tags}},
+			mapSlice(loaded, func(e PersistedEvent) any { return e.Data }))
+	}
+	assert.Equal(t, [][]string{hashes[0], hashes[0], hashes[0]}, hashes)
+	assert.Equal(t, [][][]byte{data[0], data[0], data[0]}, data)
+}
+
+func TestRaftCryptoShredderRequiresSharedKeyStore(t *testing.T) {
+	cluster := newRaftCluster(t, 3, RaftConfig{LinearisableReads: true})
+	require.NoError(t, AddJsonEventDeserialiser[customer_registered_v1](*cluster.config.EventDeserialiser))
+	shredder := NewCryptoShredder(NewMemoryKeyStore())
+	shredder.Erased = "[erased]"
+	session := func(id string, shredder *CryptoShredder) *Session {
+		config := *cluster.config
+		config.SaveMiddleware = []EventMiddleware{shredder.SaveMiddleware()}
+		config.LoadMiddleware = []EventMiddleware{shredder.LoadMiddleware()}
+		sessionProvider, err := NewSessionProvider(cluster.providers[id], config)
+		require.NoError(t, err)
+		session, err := sessionProvider.NewSession("default")
+		require.NoError(t, err)
+		return session
+	}
+	names := func(session *Session) []string {
+		events, err := session.LoadEvents(LoadEventArgs{})
+		require.NoError(t, err)
+		return mapSlice(events, func(e PersistedEvent) string { return e.Data.(customer_registered_v1).Name })
+	}
+	leader := cluster.leader()
+	require.NoError(t, cluster.providers[leader].NewTenant("default"))
+	saveCustomerEvents(t, session(cluster.follower(leader), shredder), "c1",
+		customer_registered_v1{CustomerId: "c1", Name: "Alice"})
+
+	for _, id := range cluster.ids {
+		assert.Equal(t, []string{"Alice"}, names(session(id, shredder)))
+		// A node with a key store of its own cannot read data encrypted through another node
+		own := NewCryptoShredder(NewMemoryKeyStore())
+		own.Erased = "[erased]"
+		assert.Equal(t, []string{"[erased]"}, names(session(id, own)))
+	}
+
+	require.NoError(t, shredder.ForgetSubject("c1"))
+	for _, id := range cluster.ids {
+		assert.Equal(t, []string{"[erased]"}, names(session(id, shredder)))
+	}
+}
@@ -0,0 +1,84 @@
+package moments
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrAggregateNotFound is returned when an aggregate's stream has no events.
+	ErrAggregateNotFound = errors.New("aggregate not found")
+	// ErrVersionNotFound is returned when an aggregate has not reached a requested version.
+	ErrVersionNotFound = errors.New("version not found")
+)
+
+// Repository loads and saves aggregates of a single type through a Session,
+// hiding the IAggregate plumbing from application code.
+type Repository[T any] struct {
+	session      *Session
+	newAggregate newAggregateFunc[T]
+}
+
+// NewRepository creates a repository that builds aggregates with the given factory.
+func NewRepository[T any](session *Session, newAggregate newAggregateFunc[T]) *Repository[T] {
+	return &Repository[T]{session: session, newAggregate: newAggregate}
+}
+
+// Get loads the aggregate with the given id, returning ErrAggregateNotFound if it has no events.
+func (r *Repository[T]) Get(id string) (*Aggregate[T], error) {
+	aggregate, err := r.GetOrCreate(id)
+	if err != nil {
+		return nil, err
+	}
+	if aggregate.Version() == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrAggregateNotFound, aggregate.StreamId())
+	}
+	return aggregate, nil
+}
+
+// GetOrCreate loads the aggregate with the given id, returning a new aggregate
+// with that id if it has no events. An empty id creates an aggregate with a generated id.
+func (r *Repository[T]) GetOrCreate(id string) (*Aggregate[T], error) {
+	aggregate := r.newAggregate(WithId[T](id))
+	if err := r.session.LoadAggregate(aggregate); err != nil {
+		return nil, err
+	}
+	return aggregate, nil
+}
+
+// GetAtVersion loads the aggregate with the given id as it was at the given version.
+func (r *Repository[T]) GetAtVersion(id string, version Version) (*Aggregate[T], error) {
+	aggregate := r.newAggregate(WithId[T](id))
+	if err := r.session.LoadAggregateAt(aggregate, version); err != nil {
+		return nil, err
+	}
+	return aggregate, nil
+}
+
+// GetAsOf loads the aggregate with the given id as it was at the given time.
+func (r *Repository[T]) GetAsOf(id string, asOf time.Time) (*Aggregate[T], error) {
+	aggregate := r.newAggregate(WithId[T](id))
+	if err := r.session.LoadAggregateAsOf(aggregate, asOf); err != nil {
+		return nil, err
+	}
+	return aggregate, nil
+}
+
+// Save persists the aggregate's unsaved events.
+func (r *Repository[T]) Save(aggregate *Aggregate[T]) error {
+	return r.session.Save(aggregate)
+}
+
+// Exists reports whether the aggregate with the given id has any events.
+func (r *Repository[T]) Exists(id string) (bool, error) {
+	aggregate := r.newAggregate(WithId[T](id))
+	events, err := r.session.LoadEvents(LoadEventArgs{
+		StreamId: aggregate.StreamId(),
+		Count:    1,
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(events) > 0, nil
+}
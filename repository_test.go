@@ -0,0 +1,80 @@
+package moments
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepositoryGetNotFound(t *testing.T) {
+	session := createEventSourcedSession(t)
+	defer session.Close()
+	repo := NewRepository(session, newCalculatorAggregate)
+
+	_, err := repo.Get("missing")
+	assert.ErrorIs(t, err, ErrAggregateNotFound)
+}
+
+func TestRepositoryGetOrCreateAndSave(t *testing.T) {
+	session := createEventSourcedSession(t)
+	defer session.Close()
+	repo := NewRepository(session, newCalculatorAggregate)
+
+	calc, err := repo.GetOrCreate("c1")
+	assert.NoError(t, err)
+	assert.Equal(t, "c1", calc.Id())
+	assert.Equal(t, Version(0), calc.Version())
+	calc.Apply(calculator_added_v1{Value: 2}, nil)
+	assert.NoError(t, repo.Save(calc))
+
+	loaded, err := repo.Get("c1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, loaded.State().Value)
+
+	loaded, err = repo.GetOrCreate("c1")
+	assert.NoError(t, err)
+	assert.Equal(t, Version(1), loaded.Version())
+}
+
+func TestRepositoryExists(t *testing.T) {
+	session := createEventSourcedSession(t)
+	defer session.Close()
+	repo := NewRepository(session, newCalculatorAggregate)
+
+	exists, err := repo.Exists("c1")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	calc, err := repo.GetOrCreate("c1")
+	assert.NoError(t, err)
+	calc.Apply(calculator_added_v1{Value: 2}, nil)
+	assert.NoError(t, repo.Save(calc))
+
+	exists, err = repo.Exists("c1")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestRepositoryGetAtVersion(t *testing.T) {
+	session := createEventSourcedSession(t)
+	defer session.Close()
+	repo := NewRepository(session, newCalculatorAggregate)
+
+	calc, err := repo.GetOrCreate("c1")
+	assert.NoError(t, err)
+	calc.Apply(calculator_updated_v1{Value: 5}, nil)
+	calc.Apply(calculator_added_v1{Value: 2}, nil)
+	calc.Apply(calculator_added_v1{Value: 3}, nil)
+	assert.NoError(t, repo.Save(calc))
+
+	historic, err := repo.GetAtVersion("c1", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, Version(2), historic.Version())
+	assert.Equal(t, 7, historic.State().Value)
+
+	_, err = repo.GetAtVersion("c1", 4)
+	assert.ErrorIs(t, err, ErrVersionNotFound)
+
+	_, err = repo.GetAtVersion("missing", 1)
+	assert.ErrorIs(t, err, ErrAggregateNotFound)
+}
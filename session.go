@@ -1,8 +1,11 @@
 package moments
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"time"
 )
 
 type SessionProvider struct {
@@ -10,23 +13,36 @@ type SessionProvider struct {
 	Config        Config
 }
 type Session struct {
-	Store         Store
+	Store Store
+	// Context is passed to the configured middleware for every save and load made through the session
+	Context       context.Context
 	CorrelationId CorrelationId
 	CausationId   CausationId
 	Metadata      Metadata
-	tenant        TenantId
-	config        Config
-	persister     storeStrategy
+	// ChainCausation sets the CausationId of each saved event without one to the
+	// EventId of the event before it. The first event uses the session's CausationId.
+	ChainCausation bool
+	tenant         TenantId
+	config         Config
+	persister      storeStrategy
 }
 
-func NewSessionProvider(storeProvider StoreProvider, config Config) SessionProvider {
+// NewSessionProvider creates a session provider, returning an error when the config
+// references aggregates or event types that cannot be resolved.
+func NewSessionProvider(storeProvider StoreProvider, config Config) (SessionProvider, error) {
 	if config.SnapshotSerialiser == nil {
 		config.SnapshotSerialiser = &JsonSnapshotSerialiser
 	}
+	if config.Clock == nil {
+		config.Clock = SystemClock
+	}
+	if err := config.validate(); err != nil {
+		return SessionProvider{}, err
+	}
 	return SessionProvider{
 		StoreProvider: storeProvider,
 		Config:        config,
-	}
+	}, nil
 }
 
 func (sp *SessionProvider) NewSession(tenant TenantId) (*Session, error) {
@@ -42,6 +58,7 @@ func (sp *SessionProvider) NewSession(tenant TenantId) (*Session, error) {
 func newSession(tenant TenantId, store Store, config Config) Session {
 	return Session{
 		Store:         store,
+		Context:       context.Background(),
 		tenant:        tenant,
 		CorrelationId: "",
 		CausationId:   "",
@@ -50,69 +67,200 @@ func newSession(tenant TenantId, store Store, config Config) Session {
 	}
 }
 
-func (s *Session) LoadAggregate(aggregate IAggregate) error {
-	aggregateConfig, ok := s.config.Aggregates[aggregate.AggregateType()]
-	if !ok {
-		return errors.New(fmt.Sprintln("Unknown aggregate type", aggregate.AggregateType()))
+func (s *Session) LoadAggregate(aggregate IAggregate) (err error) {
+	ctx, span := s.startAggregateSpan("moments.session.load_aggregate", aggregate)
+	defer func() { endSpan(span, err) }()
+
+	s.useIdGenerator(aggregate)
+	storeStrategy, err := s.storeStrategy(aggregate)
+	if err != nil {
+		return err
 	}
-	aggregateStrategy := aggregateConfig.StoreStrategy
+	err = storeStrategy.load(withAggregateLoad(ctx), aggregate, s)
+	span.SetAttributes(Attr(AttrVersion, aggregate.Version()))
+	return err
+}
 
-	storeStrategy, ok := storeStrategies[aggregateStrategy]
-	if !ok {
-		return errors.New(fmt.Sprintln("Unknown store strategy", aggregateStrategy))
+// LoadAggregateAt loads a new aggregate as it was at the given version.
+// The nearest snapshot at or before the version is used when available.
+func (s *Session) LoadAggregateAt(aggregate IAggregate, version Version) (err error) {
+	ctx, span := s.startAggregateSpan("moments.session.load_aggregate_at", aggregate)
+	defer func() { endSpan(span, err) }()
+	return s.loadAggregateAt(ctx, aggregate, version)
+}
+
+func (s *Session) loadAggregateAt(ctx context.Context, aggregate IAggregate, version Version) error {
+	if aggregate.Version() > 0 || aggregate.HasUnsavedChanges() {
+		return errors.New("cannot load history into an already loaded aggregate")
+	}
+	s.useIdGenerator(aggregate)
+	if version == 0 {
+		return fmt.Errorf("%w: version must be greater than 0", ErrVersionNotFound)
 	}
-	return storeStrategy.load(aggregate, s)
+	storeStrategy, err := s.storeStrategy(aggregate)
+	if err != nil {
+		return err
+	}
+	if err := storeStrategy.loadTo(withAggregateLoad(ctx), aggregate, s, version); err != nil {
+		return err
+	}
+	if aggregate.Version() == 0 {
+		return fmt.Errorf("%w: %v", ErrAggregateNotFound, aggregate.StreamId())
+	}
+	if aggregate.Version() < version {
+		return fmt.Errorf("%w: %v is at version %v", ErrVersionNotFound, aggregate.StreamId(), aggregate.Version())
+	}
+	return nil
+}
+
+// LoadAggregateAsOf loads a new aggregate as it was at the given time, including every
+// event up to the first one stamped after it. Timestamps come from the clock of whichever
+// process saved each event, so later events are not assumed to have later timestamps.
+func (s *Session) LoadAggregateAsOf(aggregate IAggregate, asOf time.Time) (err error) {
+	ctx, span := s.startAggregateSpan("moments.session.load_aggregate_as_of", aggregate)
+	defer func() { endSpan(span, err) }()
+
+	ctx = withAggregateLoad(ctx)
+	events, err := s.loadEvents(ctx, LoadEventArgs{StreamId: aggregate.StreamId()})
+	if err != nil {
+		return err
+	}
+	var version Version
+	for _, evt := range events {
+		if evt.Timestamp.After(asOf) {
+			break
+		}
+		version = evt.Version
+	}
+	if version == 0 {
+		return fmt.Errorf("%w: %v as of %v", ErrAggregateNotFound, aggregate.StreamId(), asOf)
+	}
+	return s.loadAggregateAt(ctx, aggregate, version)
 }
 
-func (s *Session) Save(aggregate IAggregate) error {
+// Save persists the aggregate's unsaved events. When the session has no CorrelationId
+// the id of the current trace is used, linking the events to the trace.
+func (s *Session) Save(aggregate IAggregate) (err error) {
+	ctx, span := s.startAggregateSpan("moments.session.save", aggregate)
+	defer func() { endSpan(span, err) }()
+	s.useIdGenerator(aggregate)
+
+	correlationId := s.CorrelationId
+	if correlationId == "" {
+		correlationId = CorrelationId(span.TraceId())
+	}
+	span.SetAttributes(
+		Attr(AttrVersion, aggregate.Version()),
+		Attr(AttrEventCount, len(aggregate.UnsavedEvents())),
+		Attr(AttrCorrelationId, string(correlationId)))
+	ctx = context.WithValue(ctx, correlationIdKey{}, correlationId)
+
+	storeStrategy, err := s.storeStrategy(aggregate)
+	if err != nil {
+		return err
+	}
+	return storeStrategy.save(ctx, aggregate, s)
+}
+
+func (s *Session) startAggregateSpan(name string, aggregate IAggregate) (context.Context, Span) {
+	return s.config.startSpan(s.Context, name,
+		Attr(AttrTenant, string(s.tenant)),
+		Attr(AttrAggregateType, string(aggregate.AggregateType())),
+		Attr(AttrStreamId, aggregate.StreamId().String()))
+}
+
+// NewEvent creates an event with an id from the configured IdGenerator unless args has one.
+func (s *Session) NewEvent(data any, args *ApplyArgs) Event {
+	return newEvent(data, args, s.config.idGenerator())
+}
+
+// useIdGenerator has aggregates created without an IdGenerator take their
+// event ids from the configured IdGenerator.
+func (s *Session) useIdGenerator(aggregate IAggregate) {
+	if a, ok := aggregate.(interface{ useDefaultIdGenerator(IdGenerator) }); ok {
+		a.useDefaultIdGenerator(s.config.idGenerator())
+	}
+}
+
+func (s *Session) storeStrategy(aggregate IAggregate) (storeStrategy, error) {
 	aggregateConfig, ok := s.config.Aggregates[aggregate.AggregateType()]
 	if !ok {
-		return errors.New(fmt.Sprintln("Unknown aggregate type", aggregate.AggregateType()))
+		return nil, errors.New(fmt.Sprintln("Unknown aggregate type", aggregate.AggregateType()))
 	}
 	aggregateStrategy := aggregateConfig.StoreStrategy
 
 	storeStrategy, ok := storeStrategies[aggregateStrategy]
 	if !ok {
-		return errors.New(fmt.Sprintln("Unknown store strategy", aggregateStrategy))
+		return nil, errors.New(fmt.Sprintln("Unknown store strategy", aggregateStrategy))
 	}
-	return storeStrategy.save(aggregate, s)
+	return storeStrategy, nil
 }
 
-func (s *Session) newSaveEventArgs(streamId StreamId, events []Event, expectedVersion Version) SaveEventArgs {
+func (s *Session) newSaveEventArgs(
+	ctx context.Context, streamId StreamId, events []Event, expectedVersion Version,
+) SaveEventArgs {
+	now := s.config.now()
+	events = slices.Clone(events)
+	for i := range events {
+		if events[i].Timestamp.IsZero() {
+			events[i].Timestamp = now
+		}
+		if s.ChainCausation && i > 0 && events[i].CausationId == "" {
+			events[i].CausationId = CausationId(events[i-1].EventId)
+		}
+	}
+	correlationId, ok := ctx.Value(correlationIdKey{}).(CorrelationId)
+	if !ok {
+		correlationId = s.CorrelationId
+	}
 	args := SaveEventArgs{
+		Context:         ctx,
 		StreamId:        streamId,
 		Events:          events,
 		ExpectedVersion: expectedVersion,
-		CorrelationId:   s.CorrelationId,
+		CorrelationId:   correlationId,
 		CausationId:     s.CausationId,
 		Metadata:        s.Metadata,
 	}
 	return args
 }
 
-func (s *Session) saveEvents(streamId StreamId, events []Event, expectedVersion Version) error {
-	if expectedVersion == 0 {
-		return errors.New("cannot save stream with no events")
-	}
-
-	a := s.newSaveEventArgs(streamId, events, expectedVersion)
-	return s.Store.SaveEvents(a)
+func (s *Session) saveEvents(ctx context.Context, streamId StreamId, events []Event, expectedVersion Version) error {
+	return s.saveEventsWithSnapshot(ctx, streamId, events, expectedVersion, nil)
 }
 
 func (s *Session) saveEventsWithSnapshot(
-	streamId StreamId, events []Event, expectedVersion Version, snapshot *Snapshot,
-) error {
+	ctx context.Context, streamId StreamId, events []Event, expectedVersion Version, snapshot *Snapshot,
+) (err error) {
 	if expectedVersion == 0 {
 		return errors.New("cannot save stream with no events")
 	}
 
-	a := s.newSaveEventArgs(streamId, events, expectedVersion)
+	ctx, span := s.config.startSpan(ctx, "moments.store.save_events",
+		Attr(AttrTenant, string(s.tenant)),
+		Attr(AttrStreamId, streamId.String()),
+		Attr(AttrVersion, expectedVersion),
+		Attr(AttrEventCount, len(events)))
+	defer func() { endSpan(span, err) }()
+
+	a := s.newSaveEventArgs(ctx, streamId, events, expectedVersion)
 	a.Snapshot = snapshot
+	if err := s.config.beforeSave(&a); err != nil {
+		return err
+	}
 	return s.Store.SaveEvents(a)
 }
 
+func (s *Session) loadSnapshot(ctx context.Context, id SnapshotId) (snapshot *Snapshot, err error) {
+	_, span := s.config.startSpan(ctx, "moments.store.load_snapshot",
+		Attr(AttrTenant, string(s.tenant)),
+		Attr(AttrStreamId, id.StreamId.String()))
+	defer func() { endSpan(span, err) }()
+	return s.Store.LoadSnapshot(id)
+}
+
 func (s *Session) LoadStream(streamId StreamId) ([]PersistedEvent, error) {
-	events, err := s.Store.LoadEvents(LoadEventArgs{StreamId: streamId})
+	events, err := s.LoadEvents(LoadEventArgs{StreamId: streamId})
 	if err != nil {
 		return nil, err
 	}
@@ -122,7 +270,32 @@ func (s *Session) LoadStream(streamId StreamId) ([]PersistedEvent, error) {
 func (s *Session) LoadEvents(
 	options LoadEventArgs,
 ) ([]PersistedEvent, error) {
-	return s.Store.LoadEvents(options)
+	ctx := options.Context
+	if ctx == nil {
+		ctx = s.Context
+	}
+	return s.loadEvents(ctx, options)
+}
+
+func (s *Session) loadEvents(ctx context.Context, options LoadEventArgs) (events []PersistedEvent, err error) {
+	ctx, span := s.config.startSpan(ctx, "moments.store.load_events",
+		Attr(AttrTenant, string(s.tenant)),
+		Attr(AttrStreamId, options.StreamId.String()))
+	defer func() {
+		span.SetAttributes(Attr(AttrEventCount, len(events)))
+		endSpan(span, err)
+	}()
+	options.Context = ctx
+	// Count applies to the events load middleware keeps, so the store cannot apply it
+	count := options.Count
+	if len(s.config.LoadMiddleware) > 0 {
+		options.Count = 0
+	}
+	loaded, err := s.Store.LoadEvents(options)
+	if err != nil || len(s.config.LoadMiddleware) == 0 {
+		return loaded, err
+	}
+	return s.config.afterLoad(ctx, loaded, count)
 }
 
 func (s *Session) Close() {
@@ -0,0 +1,168 @@
+package moments
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadAggregateAt(t *testing.T) {
+	session := createEventSourcedSession(t)
+	defer session.Close()
+	calc := newCalculator("")
+	calc.update(5)
+	calc.add(2)
+	calc.add(3)
+	assert.NoError(t, session.Save(calc))
+
+	historic := newCalculator(calc.Id())
+	assert.NoError(t, session.LoadAggregateAt(historic, 2))
+	assert.Equal(t, Version(2), historic.Version())
+	assert.Equal(t, 7, historic.State().Value)
+
+	assert.ErrorIs(t, session.LoadAggregateAt(newCalculator(calc.Id()), 4), ErrVersionNotFound)
+	assert.ErrorIs(t, session.LoadAggregateAt(newCalculator(""), 1), ErrAggregateNotFound)
+	assert.Error(t, session.LoadAggregateAt(historic, 3))
+}
+
+func TestLoadAggregateAtUsesSnapshotAtOrBeforeVersion(t *testing.T) {
+	session := createSnapshotSession(t)
+	defer session.Close()
+	calc := newCalculator("")
+	calc.update(5)
+	calc.add(2)
+	calc.add(3)
+	assert.NoError(t, session.Save(calc))
+
+	// Replace the snapshot with a recognisable state to show when it is used
+	state, err := JsonSnapshotSerialiser.Marshal(calculatorState{Value: 999})
+	assert.NoError(t, err)
+	assert.NoError(t, session.Store.SaveSnapshot(&Snapshot{
+		Id: NewSnapshotId(calc.StreamId(), calc.SchemaVersion()), Version: 3, State: state,
+	}))
+
+	latest := newCalculator(calc.Id())
+	assert.NoError(t, session.LoadAggregateAt(latest, 3))
+	assert.Equal(t, 999, latest.State().Value)
+
+	historic := newCalculator(calc.Id())
+	assert.NoError(t, session.LoadAggregateAt(historic, 2))
+	assert.Equal(t, 7, historic.State().Value)
+}
+
+func TestLoadAggregateAsOf(t *testing.T) {
+	session := createEventSourcedSession(t)
+	defer session.Close()
+	calc := newCalculator("")
+	calc.update(5)
+	assert.NoError(t, session.Save(calc))
+	time.Sleep(time.Millisecond)
+	yesterday := time.Now()
+	time.Sleep(time.Millisecond)
+	calc.add(2)
+	assert.NoError(t, session.Save(calc))
+
+	historic := newCalculator(calc.Id())
+	assert.NoError(t, session.LoadAggregateAsOf(historic, yesterday))
+	assert.Equal(t, Version(1), historic.Version())
+	assert.Equal(t, 5, historic.State().Value)
+
+	current := newCalculator(calc.Id())
+	assert.NoError(t, session.LoadAggregateAsOf(current, time.Now()))
+	assert.Equal(t, 7, current.State().Value)
+
+	err := session.LoadAggregateAsOf(newCalculator(calc.Id()), yesterday.Add(-time.Hour))
+	assert.ErrorIs(t, err, ErrAggregateNotFound)
+}
+
+func TestLoadAggregateAsOfWithOutOfOrderTimestamps(t *testing.T) {
+	session := createMiddlewareSession(t, nil, []EventMiddleware{
+		func(ctx context.Context, event *PersistedEvent) error {
+			if _, ok := event.Data.(calculator_updated_v1); ok {
+				return ErrSkipEvent
+			}
+			return nil
+		},
+	})
+	defer session.Close()
+	start := time.Date(2024, 5, 6, 7, 0, 0, 0, time.UTC)
+	calc := newCalculator("c1")
+	calc.Apply(calculator_updated_v1{Value: 5}, &ApplyArgs{Timestamp: start})
+	// Saved by a process whose clock runs behind
+	calc.Apply(calculator_added_v1{Value: 2}, &ApplyArgs{Timestamp: start.Add(2 * time.Minute)})
+	calc.Apply(calculator_added_v1{Value: 3}, &ApplyArgs{Timestamp: start.Add(time.Minute)})
+	assert.NoError(t, session.Save(calc))
+
+	historic := newCalculator("c1")
+	assert.NoError(t, session.LoadAggregateAsOf(historic, start.Add(time.Minute)))
+	assert.Equal(t, Version(1), historic.Version())
+	assert.Equal(t, 5, historic.State().Value)
+}
+
+func TestSaveStampsEventsFromClock(t *testing.T) {
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	session := createSession(t, Config{
+		Aggregates: map[AggregateType]AggregateConfig{
+			calculatorType: {StoreStrategy: eventSourced},
+		},
+		EventDeserialiser: createEventDeserialiser(),
+		Clock:             ClockFunc(func() time.Time { return now }),
+	})
+	defer session.Close()
+
+	imported := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+	calc := newCalculator("")
+	calc.Apply(calculator_updated_v1{Value: 1}, &ApplyArgs{Timestamp: imported})
+	calc.add(2)
+	assert.NoError(t, session.Save(calc))
+
+	events, err := session.LoadStream(calc.StreamId())
+	assert.NoError(t, err)
+	assert.Equal(t, imported, events[0].Timestamp)
+	assert.Equal(t, now, events[1].Timestamp)
+}
+
+func TestPerEventMetadataMergesWithSessionMetadata(t *testing.T) {
+	session := createEventSourcedSession(t)
+	defer session.Close()
+	session.CausationId = "command-1"
+	session.Metadata["user"] = "alice"
+	session.Metadata["source"] = "session"
+
+	calc := newCalculator("")
+	calc.Apply(calculator_updated_v1{Value: 1}, &ApplyArgs{
+		Metadata:    Metadata{"source": "import", "row": 7},
+		CausationId: "other-event",
+	})
+	calc.add(2)
+	assert.NoError(t, session.Save(calc))
+	session.Metadata["user"] = "bob"
+
+	events, err := session.LoadStream(calc.StreamId())
+	assert.NoError(t, err)
+	assert.Equal(t, Metadata{"user": "alice", "source": "import", "row": 7}, events[0].Metadata)
+	assert.Equal(t, CausationId("other-event"), events[0].CausationId)
+	assert.Equal(t, Metadata{"user": "alice", "source": "session"}, events[1].Metadata)
+	assert.Equal(t, CausationId("command-1"), events[1].CausationId)
+}
+
+func TestChainCausation(t *testing.T) {
+	session := createEventSourcedSession(t)
+	defer session.Close()
+	session.CausationId = "command-1"
+	session.ChainCausation = true
+
+	calc := newCalculator("")
+	calc.update(1)
+	calc.add(2)
+	calc.subtract(1)
+	assert.NoError(t, session.Save(calc))
+
+	events, err := session.LoadStream(calc.StreamId())
+	assert.NoError(t, err)
+	assert.Equal(t, CausationId("command-1"), events[0].CausationId)
+	assert.Equal(t, CausationId(events[0].EventId), events[1].CausationId)
+	assert.Equal(t, CausationId(events[1].EventId), events[2].CausationId)
+}
@@ -0,0 +1,144 @@
+package moments
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// ErrInvalidSignature is returned when a loaded event's signature cannot be verified.
+var ErrInvalidSignature = errors.New("invalid event signature")
+
+// Signer signs events as they are appended. The signed message is the event's Hash,
+// which covers its data, envelope and position in the log.
+type Signer interface {
+	Sign(message []byte) (keyId string, signature []byte, err error)
+}
+
+// SignatureVerifier verifies signatures made by a Signer.
+type SignatureVerifier interface {
+	Verify(keyId string, message []byte, signature []byte) error
+}
+
+type SignatureVerification int
+
+const (
+	// IgnoreSignatures loads events without verifying their signatures
+	IgnoreSignatures SignatureVerification = iota
+	// WarnOnInvalidSignature logs a warning for events that are unsigned or fail verification
+	WarnOnInvalidSignature
+	// RejectInvalidSignature fails loads containing events that are unsigned or fail verification
+	RejectInvalidSignature
+)
+
+func (v SignatureVerification) String() string {
+	switch v {
+	case IgnoreSignatures:
+		return "IgnoreSignatures"
+	case WarnOnInvalidSignature:
+		return "WarnOnInvalidSignature"
+	case RejectInvalidSignature:
+		return "RejectInvalidSignature"
+	default:
+		return "Unknown"
+	}
+}
+
+// Ed25519Signer signs events with an Ed25519 private key.
+type Ed25519Signer struct {
+	KeyId      string
+	PrivateKey ed25519.PrivateKey
+}
+
+func NewEd25519Signer(keyId string, privateKey ed25519.PrivateKey) *Ed25519Signer {
+	return &Ed25519Signer{KeyId: keyId, PrivateKey: privateKey}
+}
+
+func (s *Ed25519Signer) Sign(message []byte) (string, []byte, error) {
+	return s.KeyId, ed25519.Sign(s.PrivateKey, message), nil
+}
+
+// Ed25519Verifier verifies signatures against a set of trusted public keys.
+type Ed25519Verifier struct {
+	mu   sync.RWMutex
+	keys map[string]ed25519.PublicKey
+}
+
+func NewEd25519Verifier() *Ed25519Verifier {
+	return &Ed25519Verifier{keys: map[string]ed25519.PublicKey{}}
+}
+
+// AddKey trusts the public key for signatures made with the given key id.
+func (v *Ed25519Verifier) AddKey(keyId string, publicKey ed25519.PublicKey) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.keys[keyId] = publicKey
+}
+
+func (v *Ed25519Verifier) Verify(keyId string, message []byte, signature []byte) error {
+	v.mu.RLock()
+	key, ok := v.keys[keyId]
+	v.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: unknown key %v", ErrInvalidSignature, keyId)
+	}
+	if !ed25519.Verify(key, message, signature) {
+		return fmt.Errorf("%w: signature does not match key %v", ErrInvalidSignature, keyId)
+	}
+	return nil
+}
+
+// sign signs the event's hash with the configured Signer, if any.
+func (c *Config) sign(event *PersistedEvent) error {
+	if c.Signer == nil {
+		return nil
+	}
+	keyId, signature, err := c.Signer.Sign([]byte(event.Hash))
+	if err != nil {
+		return err
+	}
+	event.SignatureKeyId = keyId
+	event.Signature = signature
+	return nil
+}
+
+// verifySignature checks that a loaded event matches its hash and that the hash was signed
+// by a trusted key, then warns or fails according to the SignatureVerification mode.
+func (c *Config) verifySignature(event PersistedEvent, payload []byte) error {
+	if c.SignatureVerification == IgnoreSignatures {
+		return nil
+	}
+	err := c.checkSignature(event, payload)
+	if err == nil {
+		return nil
+	}
+	if c.SignatureVerification == WarnOnInvalidSignature {
+		slog.Warn("event signature verification failed",
+			"stream", event.StreamId.String(), "version", event.Version, "err", err)
+		return nil
+	}
+	return err
+}
+
+func (c *Config) checkSignature(event PersistedEvent, payload []byte) error {
+	if len(event.Signature) == 0 {
+		return fmt.Errorf("%w: event %v is not signed", ErrInvalidSignature, event.EventId)
+	}
+	hash, err := eventHash(event, payload)
+	if err != nil {
+		return err
+	}
+	if hash != event.Hash {
+		return fmt.Errorf("%w: event %v does not match its hash", ErrInvalidSignature, event.EventId)
+	}
+	if c.SignatureVerifier == nil {
+		return fmt.Errorf("%w: no SignatureVerifier configured", ErrInvalidSignature)
+	}
+	err = c.SignatureVerifier.Verify(event.SignatureKeyId, []byte(event.Hash), event.Signature)
+	if err != nil && !errors.Is(err, ErrInvalidSignature) {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+	return err
+}
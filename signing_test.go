@@ -0,0 +1,100 @@
+package moments
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSigningKeys(t *testing.T) (*Ed25519Signer, *Ed25519Verifier) {
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	verifier := NewEd25519Verifier()
+	verifier.AddKey("service-a", public)
+	return NewEd25519Signer("service-a", private), verifier
+}
+
+func createSigningSession(t *testing.T, signer Signer, verifier SignatureVerifier, mode SignatureVerification) (*Session, *MemoryStore) {
+	session := createSession(t, Config{
+		Aggregates: map[AggregateType]AggregateConfig{
+			calculatorType: {StoreStrategy: eventSourced},
+		},
+		EventDeserialiser:     createEventDeserialiser(),
+		Signer:                signer,
+		SignatureVerifier:     verifier,
+		SignatureVerification: mode,
+	})
+	return session, session.Store.(*MemoryStore)
+}
+
+func TestSignedEventsVerifyOnLoad(t *testing.T) {
+	signer, verifier := newSigningKeys(t)
+	session, _ := createSigningSession(t, signer, verifier, RejectInvalidSignature)
+	saveCalculators(t, session)
+
+	events, err := session.LoadEvents(LoadEventArgs{})
+	require.NoError(t, err)
+	require.Len(t, events, 6)
+	for _, evt := range events {
+		assert.Equal(t, "service-a", evt.SignatureKeyId)
+		assert.Len(t, evt.Signature, ed25519.SignatureSize)
+	}
+}
+
+func TestTamperedEventsAreRejectedOrWarned(t *testing.T) {
+	signer, verifier := newSigningKeys(t)
+	session, store := createSigningSession(t, signer, verifier, RejectInvalidSignature)
+	saveCalculators(t, session)
+	store.state.eventData[2] = []byte(`{"Value":100}`)
+
+	_, err := session.LoadEvents(LoadEventArgs{})
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	store.config.SignatureVerification = WarnOnInvalidSignature
+	events, err := session.LoadEvents(LoadEventArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, calculator_added_v1{Value: 100}, events[1].Data)
+}
+
+func TestEventsSignedWithUntrustedKeysAreRejected(t *testing.T) {
+	signer, _ := newSigningKeys(t)
+	_, otherVerifier := newSigningKeys(t)
+	session, store := createSigningSession(t, signer, otherVerifier, IgnoreSignatures)
+	saveCalculators(t, session)
+	store.config.SignatureVerification = RejectInvalidSignature
+
+	_, err := session.LoadEvents(LoadEventArgs{})
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestUnsignedEventsAreRejected(t *testing.T) {
+	_, verifier := newSigningKeys(t)
+	session, store := createSigningSession(t, nil, verifier, IgnoreSignatures)
+	saveCalculators(t, session)
+	store.config.SignatureVerification = RejectInvalidSignature
+
+	_, err := session.LoadEvents(LoadEventArgs{})
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestConsumerVerifiesEventsReplicatedFromProducer(t *testing.T) {
+	signer, verifier := newSigningKeys(t)
+	producer, _ := createSigningSession(t, signer, nil, IgnoreSignatures)
+	saveCalculators(t, producer)
+	events, err := producer.LoadEvents(LoadEventArgs{})
+	require.NoError(t, err)
+
+	// The consumer only holds the producer's public key
+	consumer, store := createSigningSession(t, nil, verifier, RejectInvalidSignature)
+	require.NoError(t, store.ImportEvents(events))
+	loaded, err := consumer.LoadEvents(LoadEventArgs{})
+	require.NoError(t, err)
+	assert.Len(t, loaded, 6)
+}
+
+func TestConfigRequiresVerifierForSignatureVerification(t *testing.T) {
+	config := Config{SignatureVerification: WarnOnInvalidSignature}
+	assert.Error(t, config.validate())
+}
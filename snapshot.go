@@ -41,8 +41,18 @@ var JsonSnapshotSerialiser SnapshotSerialiser = SnapshotSerialiser{
 	},
 }
 
+var GobSnapshotSerialiser SnapshotSerialiser = SnapshotSerialiser{
+	Marshal:   gobMarshal,
+	Unmarshal: gobUnmarshal,
+}
+
 type SnapshotStore interface {
 	SaveSnapshot(snapshot *Snapshot) error
 	LoadSnapshot(id SnapshotId) (*Snapshot, error)
 	DeleteSnapshot(id SnapshotId) error
 }
+
+// SnapshotLister is implemented by stores that can list every snapshot they hold.
+type SnapshotLister interface {
+	Snapshots() ([]Snapshot, error)
+}
@@ -1,16 +1,33 @@
 package moments
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrConcurrencyConflict is returned by SaveEvents when the stream was modified
+// since the aggregate was loaded.
+var ErrConcurrencyConflict = errors.New("concurrency conflict")
+
 type LoadEventArgs struct {
+	// Context is passed to the configured load middleware by the session
+	Context      context.Context
 	StreamId     StreamId
 	Count        uint
 	FromVersion  Version
 	ToVersion    Version
 	FromSequence Sequence
 	ToSequence   Sequence
-	Descending   bool
+	// ToTimestamp excludes events stamped after the given time when set
+	ToTimestamp time.Time
+	Descending  bool
 }
 
 type SaveEventArgs struct {
+	// Context is passed to the configured save middleware by the session
+	Context         context.Context
 	StreamId        StreamId
 	Events          []Event
 	CorrelationId   CorrelationId
@@ -19,6 +36,55 @@ type SaveEventArgs struct {
 	ExpectedVersion Version
 	Snapshot        *Snapshot
 }
+
+// eventLogHead is the position the events of a save are appended at.
+type eventLogHead struct {
+	// version is the stream's version
+	version Version
+	// sequence is the GlobalSequence of the tenant's last event
+	sequence Sequence
+	// streamHash and logHash are the hashes of the last event of the stream and of the tenant
+	streamHash string
+	logHash    string
+}
+
+// persistEvents builds the events of a save appended at head, sequencing, stamping,
+// serialising, hashing and signing each of them. The events keep their Data and hold
+// their serialised form in Payload.
+func (c *Config) persistEvents(args SaveEventArgs, head eventLogHead) ([]PersistedEvent, error) {
+	endVersion := head.version + Version(len(args.Events))
+	if args.ExpectedVersion != endVersion {
+		return nil, fmt.Errorf("%w: unexpected version. expected %v actual %v",
+			ErrConcurrencyConflict, args.ExpectedVersion, endVersion)
+	}
+	persisted := make([]PersistedEvent, len(args.Events))
+	previousHash, previousGlobalHash := head.streamHash, head.logHash
+	for i, evt := range args.Events {
+		seq := head.sequence + Sequence(i) + 1
+		pe := evt.ToPersistedEvent(args.StreamId, seq, seq,
+			head.version+Version(i)+1, args.CorrelationId, args.CausationId, args.Metadata)
+		if pe.Timestamp.IsZero() {
+			pe.Timestamp = c.now()
+		}
+		payload, err := c.marshalEvent(&pe)
+		if err != nil {
+			return nil, err
+		}
+		pe.PreviousHash = previousHash
+		pe.PreviousGlobalHash = previousGlobalHash
+		if pe.Hash, err = eventHash(pe, payload); err != nil {
+			return nil, err
+		}
+		previousHash, previousGlobalHash = pe.Hash, pe.Hash
+		if err := c.sign(&pe); err != nil {
+			return nil, err
+		}
+		pe.Payload = payload
+		persisted[i] = pe
+	}
+	return persisted, nil
+}
+
 type Store interface {
 	SnapshotStore
 	SaveEvents(
@@ -27,3 +93,10 @@ type Store interface {
 	LoadEvents(options LoadEventArgs) ([]PersistedEvent, error)
 	Close()
 }
+
+// EventImporter is implemented by stores that can append events exactly as they were
+// persisted by another store, keeping their sequences, versions, ids and timestamps.
+// Save middleware is not run on imported events.
+type EventImporter interface {
+	ImportEvents(events []PersistedEvent) error
+}
@@ -1,7 +1,18 @@
 package moments
 
+import (
+	"errors"
+	"fmt"
+)
+
 type StoreProvider interface {
 	TenantProvider
 	NewStore(tenant TenantId) (Store, error)
 	Close()
 }
+
+// errUnsupported is returned by decorating providers and stores when the value they
+// decorate does not implement an optional interface they forward.
+func errUnsupported(value any, iface string) error {
+	return fmt.Errorf("%w: %T does not implement %v", errors.ErrUnsupported, value, iface)
+}
@@ -1,5 +1,7 @@
 package moments
 
+import "context"
+
 type storeStrategyType int
 
 const (
@@ -19,8 +21,10 @@ func (a storeStrategyType) String() string {
 }
 
 type storeStrategy interface {
-	load(aggregate IAggregate, session *Session) error
-	save(aggregate IAggregate, session *Session) error
+	load(ctx context.Context, aggregate IAggregate, session *Session) error
+	// loadTo loads an aggregate up to and including the given version
+	loadTo(ctx context.Context, aggregate IAggregate, session *Session, version Version) error
+	save(ctx context.Context, aggregate IAggregate, session *Session) error
 }
 
 // storeStrategies is a map of StoreStrategyType to IStoreStrategy
@@ -31,25 +35,36 @@ var storeStrategies = map[storeStrategyType]storeStrategy{
 
 type eventSourcedPersistenceStrategy struct{}
 
-func (s *eventSourcedPersistenceStrategy) load(aggregate IAggregate, session *Session) error {
+func (s *eventSourcedPersistenceStrategy) load(ctx context.Context, aggregate IAggregate, session *Session) error {
 	streamId := aggregate.StreamId()
 	fromVersion := aggregate.Version() + Version(1)
-	events, err := session.LoadEvents(LoadEventArgs{
+	events, err := session.loadEvents(ctx, LoadEventArgs{
 		StreamId:    streamId,
 		FromVersion: fromVersion,
 	})
 	if err != nil {
 		return err
 	}
-	aggregate.Load(anySlice(events))
-	return nil
+	return aggregate.Load(anySlice(events))
+}
+
+func (s *eventSourcedPersistenceStrategy) loadTo(ctx context.Context, aggregate IAggregate, session *Session, version Version) error {
+	events, err := session.loadEvents(ctx, LoadEventArgs{
+		StreamId:    aggregate.StreamId(),
+		FromVersion: aggregate.Version() + Version(1),
+		ToVersion:   version,
+	})
+	if err != nil {
+		return err
+	}
+	return aggregate.Load(anySlice(events))
 }
 
-func (s *eventSourcedPersistenceStrategy) save(agg IAggregate, session *Session) error {
+func (s *eventSourcedPersistenceStrategy) save(ctx context.Context, agg IAggregate, session *Session) error {
 	events := agg.UnsavedEvents()
 
 	version := agg.Version()
-	err := session.saveEvents(agg.StreamId(), events, version)
+	err := session.saveEvents(ctx, agg.StreamId(), events, version)
 	if err != nil {
 		return err
 	}
@@ -59,36 +74,73 @@ func (s *eventSourcedPersistenceStrategy) save(agg IAggregate, session *Session)
 
 type snapshotStoreStrategy struct{}
 
-func (s *snapshotStoreStrategy) load(aggregate IAggregate, session *Session) error {
+func (s *snapshotStoreStrategy) load(ctx context.Context, aggregate IAggregate, session *Session) error {
 	streamId := aggregate.StreamId()
-	id := NewSnapshotId(streamId, aggregate.SchemaVersion())
-	state, err := session.Store.LoadSnapshot(id)
-	if err != nil {
+	if err := s.loadSnapshot(ctx, aggregate, session, 0); err != nil {
 		return err
 	}
-	if state != nil {
-		aggregate.loadSnapshot(state, session.config.SnapshotSerialiser)
-	}
 	fromVersion := aggregate.Version() + Version(1)
-	events, err := session.LoadEvents(LoadEventArgs{
+	events, err := session.loadEvents(ctx, LoadEventArgs{
 		StreamId:    streamId,
 		FromVersion: fromVersion,
 	})
 	if err != nil {
 		return err
 	}
-	aggregate.Load(anySlice(events))
-	return nil
+	return aggregate.Load(anySlice(events))
+}
+
+// loadTo uses the stored snapshot when it was taken at or before the target version,
+// otherwise the aggregate is rebuilt from its events.
+func (s *snapshotStoreStrategy) loadTo(ctx context.Context, aggregate IAggregate, session *Session, version Version) error {
+	streamId := aggregate.StreamId()
+	if err := s.loadSnapshot(ctx, aggregate, session, version); err != nil {
+		return err
+	}
+	events, err := session.loadEvents(ctx, LoadEventArgs{
+		StreamId:    streamId,
+		FromVersion: aggregate.Version() + Version(1),
+		ToVersion:   version,
+	})
+	if err != nil {
+		return err
+	}
+	return aggregate.Load(anySlice(events))
 }
 
-func (s *snapshotStoreStrategy) save(agg IAggregate, session *Session) error {
+func (s *snapshotStoreStrategy) save(ctx context.Context, agg IAggregate, session *Session) error {
 	events := agg.UnsavedEvents()
 	if len(events) == 0 {
 		return nil
 	}
+	_, span := session.config.startSpan(ctx, "moments.snapshot.save",
+		Attr(AttrStreamId, agg.StreamId().String()), Attr(AttrVersion, agg.Version()))
 	snapshot := agg.Snapshot(session.config.SnapshotSerialiser)
+	span.End()
 
 	return session.saveEventsWithSnapshot(
-		agg.StreamId(), events, agg.Version(), &snapshot,
+		ctx, agg.StreamId(), events, agg.Version(), &snapshot,
 	)
 }
+
+// loadSnapshot loads the aggregate's snapshot into it, ignoring snapshots taken
+// after maxVersion unless maxVersion is 0.
+func (s *snapshotStoreStrategy) loadSnapshot(
+	ctx context.Context, aggregate IAggregate, session *Session, maxVersion Version,
+) (err error) {
+	ctx, span := session.config.startSpan(ctx, "moments.snapshot.load",
+		Attr(AttrStreamId, aggregate.StreamId().String()))
+	defer func() { endSpan(span, err) }()
+
+	id := NewSnapshotId(aggregate.StreamId(), aggregate.SchemaVersion())
+	state, err := session.loadSnapshot(ctx, id)
+	if err != nil {
+		return err
+	}
+	if state == nil || (maxVersion != 0 && state.Version > maxVersion) {
+		return nil
+	}
+	aggregate.loadSnapshot(state, session.config.SnapshotSerialiser)
+	span.SetAttributes(Attr(AttrVersion, state.Version))
+	return nil
+}
@@ -1,6 +1,7 @@
 package moments
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -14,12 +15,12 @@ func TestLoadAndSaveSnapshotStrategy(t *testing.T) {
 		calc := newCalculator(id)
 		calc.update(5)
 		calc.add(2)
-		err := strat.save(calc, session)
+		err := strat.save(context.Background(), calc, session)
 		assert.Nil(t, err)
 	})()
 
 	loadedCalc := newCalculator(id)
-	err := strat.load(loadedCalc, session)
+	err := strat.load(context.Background(), loadedCalc, session)
 	assert.Nil(t, err)
 	assert.Equal(t, 7, loadedCalc.State().Value)
 	assert.Equal(t, Version(2), loadedCalc.Version())
@@ -0,0 +1,584 @@
+package moments
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// ExportFormatVersion is the version of the tenant export format written by ExportTenant.
+const ExportFormatVersion = 1
+
+// ErrInvalidExport is returned when an export cannot be read or does not match what was imported.
+var ErrInvalidExport = errors.New("invalid tenant export")
+
+// exportBatchSize is how many events are read from the feed or imported at a time
+const exportBatchSize = 500
+
+type exportRecordType string
+
+const (
+	exportHeaderRecord   exportRecordType = "header"
+	exportStreamRecord   exportRecordType = "stream"
+	exportEventRecord    exportRecordType = "event"
+	exportSnapshotRecord exportRecordType = "snapshot"
+	exportFooterRecord   exportRecordType = "footer"
+)
+
+// exportRecord is a single line of an export. The first line is a header, followed by the
+// tenant's events in GlobalSequence order, its streams, its snapshots and a footer.
+type exportRecord struct {
+	Type     exportRecordType
+	Header   *exportHeader  `json:",omitempty"`
+	Event    *exportEvent   `json:",omitempty"`
+	Stream   *Stream        `json:",omitempty"`
+	Snapshot *Snapshot      `json:",omitempty"`
+	Footer   *ExportSummary `json:",omitempty"`
+}
+
+type exportHeader struct {
+	FormatVersion int
+	Tenant        TenantId
+	ExportedAt    time.Time
+	// After is the GlobalSequence the export starts after, zero unless the export is incremental
+	After Sequence `json:",omitempty"`
+}
+
+// exportEvent is a persisted event with its data as written by its EventSerialiser, so it
+// can be read back without the Go types of the exporting service.
+type exportEvent struct {
+	PersistedEvent
+	Data []byte
+}
+
+// ExportSummary describes the contents of an export. It is written as the export's footer
+// and checked against the target store when the export is imported.
+type ExportSummary struct {
+	Tenant    TenantId
+	Streams   int
+	Events    int
+	Snapshots int
+	// LastSequence is the GlobalSequence of the last exported event
+	LastSequence Sequence
+	// LastHash is the Hash of the last exported event, which chains every event before it
+	LastHash string
+}
+
+// ExportTenant writes the tenant's events, streams and snapshots to w as JSON lines.
+// Events are exported as they were stored, keeping their ids, sequences, versions,
+// timestamps, metadata, hashes and signatures. Events saved while the export runs are
+// left out, as are snapshots taken after the last exported event of their stream.
+// The provider must implement ReplicationFeed and its stores SnapshotLister.
+//
+// Event data and snapshot state are exported as read through Config.PayloadCodecs, so the
+// export holds them in plaintext even when EnvelopeEncryption is configured. Personal data
+// encrypted by a CryptoShredder stays encrypted. Exports should be protected accordingly.
+func ExportTenant(w io.Writer, provider StoreProvider, config *Config, tenant TenantId) (ExportSummary, error) {
+	feed, ok := provider.(ReplicationFeed)
+	if !ok {
+		return ExportSummary{Tenant: tenant}, fmt.Errorf("%w: %T does not implement ReplicationFeed", ErrInvalidExport, provider)
+	}
+	head, err := feed.HeadSequence(tenant)
+	if err != nil {
+		return ExportSummary{Tenant: tenant}, err
+	}
+	return exportTenant(w, provider, config, tenant, 0, head)
+}
+
+// exportTenant exports the tenant's events after the given GlobalSequence up to and
+// including head, along with the streams they belong to and those streams' snapshots.
+func exportTenant(w io.Writer, provider StoreProvider, config *Config, tenant TenantId, after Sequence, head Sequence) (ExportSummary, error) {
+	summary := ExportSummary{Tenant: tenant}
+	feed, ok := provider.(ReplicationFeed)
+	if !ok {
+		return summary, fmt.Errorf("%w: %T does not implement ReplicationFeed", ErrInvalidExport, provider)
+	}
+	store, err := provider.NewStore(tenant)
+	if err != nil {
+		return summary, err
+	}
+	defer store.Close()
+	lister, ok := store.(SnapshotLister)
+	if !ok {
+		return summary, fmt.Errorf("%w: %T does not implement SnapshotLister", ErrInvalidExport, store)
+	}
+
+	out := bufio.NewWriter(w)
+	encoder := json.NewEncoder(out)
+	err = encoder.Encode(exportRecord{Type: exportHeaderRecord, Header: &exportHeader{
+		FormatVersion: ExportFormatVersion,
+		Tenant:        tenant,
+		ExportedAt:    config.now(),
+		After:         after,
+	}})
+	if err != nil {
+		return summary, err
+	}
+
+	streams := map[StreamId]*Stream{}
+	var streamIds []StreamId
+	for after < head {
+		events, err := feed.ReadFeed(tenant, after, exportBatchSize)
+		if err != nil {
+			return summary, err
+		}
+		if len(events) == 0 {
+			break
+		}
+		for _, evt := range events {
+			if evt.GlobalSequence > head {
+				break
+			}
+			data := evt.Payload
+			if data == nil {
+				if data, err = config.marshalEvent(&evt); err != nil {
+					return summary, err
+				}
+			}
+			evt.Data = nil
+			evt.Payload = nil
+			err = encoder.Encode(exportRecord{Type: exportEventRecord, Event: &exportEvent{PersistedEvent: evt, Data: data}})
+			if err != nil {
+				return summary, err
+			}
+			stream, exists := streams[evt.StreamId]
+			if !exists {
+				stream = &Stream{StreamId: evt.StreamId}
+				streams[evt.StreamId] = stream
+				streamIds = append(streamIds, evt.StreamId)
+			}
+			stream.Version = evt.Version
+			summary.Events++
+			summary.LastSequence = evt.GlobalSequence
+			summary.LastHash = evt.Hash
+		}
+		after = events[len(events)-1].GlobalSequence
+	}
+
+	for _, id := range streamIds {
+		if err := encoder.Encode(exportRecord{Type: exportStreamRecord, Stream: streams[id]}); err != nil {
+			return summary, err
+		}
+		summary.Streams++
+	}
+
+	snapshots, err := lister.Snapshots()
+	if err != nil {
+		return summary, err
+	}
+	for _, snapshot := range snapshots {
+		stream, exists := streams[snapshot.Id.StreamId]
+		if !exists || snapshot.Version > stream.Version {
+			continue
+		}
+		if err := encoder.Encode(exportRecord{Type: exportSnapshotRecord, Snapshot: &snapshot}); err != nil {
+			return summary, err
+		}
+		summary.Snapshots++
+	}
+
+	if err := encoder.Encode(exportRecord{Type: exportFooterRecord, Footer: &summary}); err != nil {
+		return summary, err
+	}
+	return summary, out.Flush()
+}
+
+// exportReader reads the records of an export between its header and footer.
+type exportReader struct {
+	decoder *json.Decoder
+	header  exportHeader
+	footer  *ExportSummary
+}
+
+func newExportReader(r io.Reader) (*exportReader, error) {
+	reader := &exportReader{decoder: json.NewDecoder(bufio.NewReader(r))}
+	var record exportRecord
+	if err := reader.decoder.Decode(&record); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidExport, err)
+	}
+	if record.Type != exportHeaderRecord || record.Header == nil {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidExport)
+	}
+	if record.Header.FormatVersion > ExportFormatVersion {
+		return nil, fmt.Errorf("%w: unsupported format version %v", ErrInvalidExport, record.Header.FormatVersion)
+	}
+	reader.header = *record.Header
+	return reader, nil
+}
+
+// next returns the next event, stream or snapshot record, or io.EOF once the footer is read.
+func (e *exportReader) next() (exportRecord, error) {
+	if e.footer != nil {
+		return exportRecord{}, io.EOF
+	}
+	var record exportRecord
+	if err := e.decoder.Decode(&record); err != nil {
+		if err == io.EOF {
+			return record, fmt.Errorf("%w: missing footer", ErrInvalidExport)
+		}
+		return record, fmt.Errorf("%w: %w", ErrInvalidExport, err)
+	}
+	switch {
+	case record.Type == exportEventRecord && record.Event != nil,
+		record.Type == exportStreamRecord && record.Stream != nil,
+		record.Type == exportSnapshotRecord && record.Snapshot != nil:
+		return record, nil
+	case record.Type == exportFooterRecord && record.Footer != nil:
+		e.footer = record.Footer
+		return exportRecord{}, io.EOF
+	default:
+		return record, fmt.Errorf("%w: unexpected %q record", ErrInvalidExport, record.Type)
+	}
+}
+
+// importBatch imports events in batches of exportBatchSize.
+type importBatch struct {
+	importer EventImporter
+	events   []PersistedEvent
+}
+
+func (b *importBatch) add(evt PersistedEvent) error {
+	b.events = append(b.events, evt)
+	if len(b.events) < exportBatchSize {
+		return nil
+	}
+	return b.flush()
+}
+
+func (b *importBatch) flush() error {
+	if len(b.events) == 0 {
+		return nil
+	}
+	err := b.importer.ImportEvents(b.events)
+	b.events = b.events[:0]
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidExport, err)
+	}
+	return nil
+}
+
+// decode returns the exported event with its data deserialised and its Payload set to the
+// exported data, so it is imported with the bytes its Hash was computed over.
+func (e *exportEvent) decode(config *Config) (PersistedEvent, error) {
+	evt := e.PersistedEvent
+	data, err := config.unmarshalEvent(evt.EventType, evt.ContentType, e.Data)
+	if err != nil {
+		return evt, err
+	}
+	evt.Data = data
+	evt.Payload = e.Data
+	return evt, nil
+}
+
+// newImportTarget creates the tenant, which must not already exist, and returns its store.
+// The tenant is deleted again if its store cannot import events.
+func newImportTarget(provider StoreProvider, tenant TenantId) (Store, EventImporter, error) {
+	if exists, err := provider.TenantExists(tenant); err != nil {
+		return nil, nil, err
+	} else if exists {
+		return nil, nil, fmt.Errorf("%w: tenant %v already exists", ErrInvalidExport, tenant)
+	}
+	if err := provider.NewTenant(tenant); err != nil {
+		return nil, nil, err
+	}
+	store, err := provider.NewStore(tenant)
+	if err != nil {
+		return nil, nil, errors.Join(err, provider.DeleteTenant(tenant))
+	}
+	importer, ok := store.(EventImporter)
+	if !ok {
+		store.Close()
+		err := fmt.Errorf("%w: %T does not implement EventImporter", ErrInvalidExport, store)
+		return nil, nil, errors.Join(err, provider.DeleteTenant(tenant))
+	}
+	return store, importer, nil
+}
+
+// ImportTenant creates a tenant from an export written by ExportTenant. The tenant is named
+// as it was exported unless a different tenant is given, and must not already exist.
+// Events keep their ids, sequences and hashes, so the stores of the provider must implement
+// EventImporter. Once imported the events, streams and snapshots held by the target store are
+// counted and its last event's hash is checked against the export, and the hash chain is
+// verified when the store is a ChainVerifier.
+// The tenant is deleted if the import fails, so the import can be retried.
+func ImportTenant(r io.Reader, provider StoreProvider, config *Config, tenant TenantId) (summary ExportSummary, err error) {
+	summary = ExportSummary{Tenant: tenant}
+	reader, err := newExportReader(r)
+	if err != nil {
+		return summary, err
+	}
+	if reader.header.After != 0 {
+		return summary, fmt.Errorf("%w: export only holds events after sequence %v", ErrInvalidExport, reader.header.After)
+	}
+	if tenant == "" {
+		tenant = reader.header.Tenant
+		summary.Tenant = tenant
+	}
+	store, importer, err := newImportTarget(provider, tenant)
+	if err != nil {
+		return summary, err
+	}
+	defer func() {
+		store.Close()
+		if err != nil {
+			err = errors.Join(err, provider.DeleteTenant(tenant))
+		}
+	}()
+
+	batch := &importBatch{importer: importer}
+	streams := map[StreamId]Version{}
+	for {
+		record, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return summary, err
+		}
+		switch record.Type {
+		case exportEventRecord:
+			evt, err := record.Event.decode(config)
+			if err != nil {
+				return summary, err
+			}
+			if err := batch.add(evt); err != nil {
+				return summary, err
+			}
+			streams[evt.StreamId] = evt.Version
+			summary.Events++
+			summary.LastSequence = evt.GlobalSequence
+			summary.LastHash = evt.Hash
+		case exportStreamRecord:
+			if streams[record.Stream.StreamId] != record.Stream.Version {
+				return summary, fmt.Errorf("%w: stream %v is at version %v, imported %v", ErrInvalidExport,
+					record.Stream.StreamId, record.Stream.Version, streams[record.Stream.StreamId])
+			}
+			summary.Streams++
+		case exportSnapshotRecord:
+			if err := batch.flush(); err != nil {
+				return summary, err
+			}
+			if err := store.SaveSnapshot(record.Snapshot); err != nil {
+				return summary, err
+			}
+			summary.Snapshots++
+		}
+	}
+	if err := batch.flush(); err != nil {
+		return summary, err
+	}
+	return summary, verifyImport(provider, store, tenant, *reader.footer, summary)
+}
+
+func verifyImport(provider StoreProvider, store Store, tenant TenantId, expected ExportSummary, imported ExportSummary) error {
+	if imported.Events != expected.Events || imported.Streams != expected.Streams || imported.Snapshots != expected.Snapshots {
+		return fmt.Errorf("%w: export has %v events, %v streams and %v snapshots, read %v, %v and %v",
+			ErrInvalidExport, expected.Events, expected.Streams, expected.Snapshots,
+			imported.Events, imported.Streams, imported.Snapshots)
+	}
+	if imported.LastHash != expected.LastHash {
+		return fmt.Errorf("%w: last hash %q does not match %q", ErrInvalidExport, imported.LastHash, expected.LastHash)
+	}
+	stored, err := storedContents(provider, store, tenant)
+	if err != nil {
+		return err
+	}
+	if stored.Events != expected.Events || stored.Streams != expected.Streams ||
+		(stored.Snapshots >= 0 && stored.Snapshots != expected.Snapshots) {
+		return fmt.Errorf("%w: export has %v events, %v streams and %v snapshots, tenant %v holds %v, %v and %v",
+			ErrInvalidExport, expected.Events, expected.Streams, expected.Snapshots,
+			tenant, stored.Events, stored.Streams, stored.Snapshots)
+	}
+	return verifyStored(provider, store, tenant, expected.LastSequence, expected.LastHash, ErrInvalidExport)
+}
+
+// storedContents counts the events, streams and snapshots the store holds for the tenant.
+// Events are read from the provider's ReplicationFeed when it has one and loaded from the
+// store otherwise. Snapshots is -1 when the store cannot list its snapshots.
+func storedContents(provider StoreProvider, store Store, tenant TenantId) (ExportSummary, error) {
+	summary := ExportSummary{Tenant: tenant, Snapshots: -1}
+	streams := map[StreamId]bool{}
+	count := func(events []PersistedEvent) {
+		for _, evt := range events {
+			streams[evt.StreamId] = true
+			summary.Events++
+			summary.LastSequence = evt.GlobalSequence
+			summary.LastHash = evt.Hash
+		}
+	}
+
+	feed, ok := provider.(ReplicationFeed)
+	for after := Sequence(0); ok; {
+		events, err := feed.ReadFeed(tenant, after, exportBatchSize)
+		if errors.Is(err, errors.ErrUnsupported) && summary.Events == 0 {
+			ok = false
+			break
+		}
+		if err != nil {
+			return summary, err
+		}
+		if len(events) == 0 {
+			break
+		}
+		count(events)
+		after = events[len(events)-1].GlobalSequence
+	}
+	if !ok {
+		events, err := store.LoadEvents(LoadEventArgs{})
+		if err != nil {
+			return summary, err
+		}
+		count(events)
+	}
+	summary.Streams = len(streams)
+
+	if lister, ok := store.(SnapshotLister); ok {
+		snapshots, err := lister.Snapshots()
+		if err != nil && !errors.Is(err, errors.ErrUnsupported) {
+			return summary, err
+		}
+		if err == nil {
+			summary.Snapshots = len(snapshots)
+		}
+	}
+	return summary, nil
+}
+
+// verifyStored checks the tenant's latest stored event is the expected one and, when the
+// store is a ChainVerifier, that its log is unbroken. Failures are wrapped in invalid.
+func verifyStored(provider StoreProvider, store Store, tenant TenantId, lastSequence Sequence, lastHash string, invalid error) error {
+	last, err := lastEvent(provider, store, tenant)
+	if err != nil {
+		return err
+	}
+	if last.GlobalSequence != lastSequence {
+		return fmt.Errorf("%w: tenant %v is at sequence %v, expected %v", invalid, tenant, last.GlobalSequence, lastSequence)
+	}
+	if last.Hash != lastHash {
+		return fmt.Errorf("%w: stored hash %q of tenant %v does not match %q", invalid, last.Hash, tenant, lastHash)
+	}
+
+	if verifier, ok := store.(ChainVerifier); ok {
+		broken, err := verifier.VerifyLog()
+		if errors.Is(err, errors.ErrUnsupported) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if broken != nil {
+			return fmt.Errorf("%w: %v", invalid, broken)
+		}
+	}
+	return nil
+}
+
+// lastEvent returns the tenant's latest event, read from the provider's ReplicationFeed
+// when it has one and loaded from the store otherwise.
+func lastEvent(provider StoreProvider, store Store, tenant TenantId) (PersistedEvent, error) {
+	if feed, ok := provider.(ReplicationFeed); ok {
+		head, err := feed.HeadSequence(tenant)
+		if err == nil && head == 0 {
+			return PersistedEvent{}, nil
+		}
+		if err == nil {
+			events, err := feed.ReadFeed(tenant, head-1, 1)
+			if err != nil || len(events) == 0 {
+				return PersistedEvent{}, err
+			}
+			return events[0], nil
+		}
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return PersistedEvent{}, err
+		}
+	}
+	events, err := store.LoadEvents(LoadEventArgs{Descending: true, Count: 1})
+	if err != nil || len(events) == 0 {
+		return PersistedEvent{}, err
+	}
+	return events[0], nil
+}
+
+// ExportTenants writes a tar archive holding an ExportTenant export of each tenant,
+// named after the tenant with a .jsonl extension. Tenant ids containing a slash are
+// rejected, as they cannot be read back from the archive as the same tenant.
+func ExportTenants(w io.Writer, provider StoreProvider, config *Config, tenants ...TenantId) ([]ExportSummary, error) {
+	archive := tar.NewWriter(w)
+	summaries := make([]ExportSummary, 0, len(tenants))
+	for _, tenant := range tenants {
+		name, err := tenantFileName(tenant)
+		if err != nil {
+			return summaries, err
+		}
+		var buf bytes.Buffer
+		summary, err := ExportTenant(&buf, provider, config, tenant)
+		if err != nil {
+			return summaries, err
+		}
+		err = archive.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0o644,
+			Size:    int64(buf.Len()),
+			ModTime: config.now(),
+		})
+		if err != nil {
+			return summaries, err
+		}
+		if _, err := buf.WriteTo(archive); err != nil {
+			return summaries, err
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, archive.Close()
+}
+
+// ImportTenants imports every tenant export in a tar archive written by ExportTenants.
+// If any import fails the tenants already imported from the archive are deleted.
+func ImportTenants(r io.Reader, provider StoreProvider, config *Config) (summaries []ExportSummary, err error) {
+	archive := tar.NewReader(r)
+	defer func() {
+		if err != nil {
+			for _, summary := range summaries {
+				err = errors.Join(err, provider.DeleteTenant(summary.Tenant))
+			}
+			summaries = nil
+		}
+	}()
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return summaries, nil
+		}
+		if err != nil {
+			return summaries, fmt.Errorf("%w: %w", ErrInvalidExport, err)
+		}
+		if header.Typeflag != tar.TypeReg || path.Ext(header.Name) != ".jsonl" {
+			continue
+		}
+		tenant := TenantId(strings.TrimSuffix(header.Name, ".jsonl"))
+		if _, err := tenantFileName(tenant); err != nil {
+			return summaries, err
+		}
+		summary, err := ImportTenant(archive, provider, config, tenant)
+		if err != nil {
+			return summaries, err
+		}
+		summaries = append(summaries, summary)
+	}
+}
+
+// tenantFileName returns the name of a tenant's export in an archive, rejecting tenant ids
+// that would not be read back as the same tenant.
+func tenantFileName(tenant TenantId) (string, error) {
+	if tenant == "" || strings.Contains(string(tenant), "/") {
+		return "", fmt.Errorf("%w: tenant id %q cannot be used as a file name", ErrInvalidExport, tenant)
+	}
+	return string(tenant) + ".jsonl", nil
+}
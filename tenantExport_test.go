@@ -0,0 +1,230 @@
+package moments
+
+import (
+	"archive/tar"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createExportProvider(t *testing.T, tenants ...TenantId) (*MemoryStoreProvider, *Config) {
+	config := &Config{
+		Aggregates: map[AggregateType]AggregateConfig{
+			calculatorType: {StoreStrategy: alwaysSnapshot},
+		},
+		EventDeserialiser: createEventDeserialiser(),
+		Clock:             ClockFunc(func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }),
+	}
+	provider := NewMemoryStoreProvider(config)
+	for _, tenant := range tenants {
+		require.NoError(t, provider.NewTenant(tenant))
+	}
+	return provider, config
+}
+
+func exportSession(t *testing.T, provider StoreProvider, config *Config, tenant TenantId) *Session {
+	sessionProvider, err := NewSessionProvider(provider, *config)
+	require.NoError(t, err)
+	session, err := sessionProvider.NewSession(tenant)
+	require.NoError(t, err)
+	return session
+}
+
+func TestExportAndImportTenant(t *testing.T) {
+	source, config := createExportProvider(t, "acme")
+	saveCalculators(t, exportSession(t, source, config, "acme"))
+
+	var buf bytes.Buffer
+	exported, err := ExportTenant(&buf, source, config, "acme")
+	require.NoError(t, err)
+	assert.Equal(t, ExportSummary{
+		Tenant: "acme", Streams: 2, Events: 6, Snapshots: 2, LastSequence: 6, LastHash: exported.LastHash,
+	}, exported)
+	assert.Len(t, strings.Split(strings.TrimSpace(buf.String()), "\n"), 12)
+
+	target, _ := createExportProvider(t)
+	imported, err := ImportTenant(&buf, target, config, "")
+	require.NoError(t, err)
+	assert.Equal(t, exported, imported)
+
+	want, err := source.ReadFeed("acme", 0, 0)
+	require.NoError(t, err)
+	got, err := target.ReadFeed("acme", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	loaded := newCalculator("c1")
+	require.NoError(t, exportSession(t, target, config, "acme").LoadAggregate(loaded))
+	assert.Equal(t, Version(4), loaded.Version())
+	assert.Equal(t, 6, loaded.State().Value)
+}
+
+func TestImportRenamesTenant(t *testing.T) {
+	source, config := createExportProvider(t, "acme")
+	saveCalculators(t, exportSession(t, source, config, "acme"))
+	var buf bytes.Buffer
+	_, err := ExportTenant(&buf, source, config, "acme")
+	require.NoError(t, err)
+
+	summary, err := ImportTenant(&buf, source, config, "acme-copy")
+	require.NoError(t, err)
+	assert.Equal(t, TenantId("acme-copy"), summary.Tenant)
+	head, err := source.HeadSequence("acme-copy")
+	require.NoError(t, err)
+	assert.Equal(t, Sequence(6), head)
+}
+
+func TestImportRejectsExistingTenant(t *testing.T) {
+	source, config := createExportProvider(t, "acme")
+	var buf bytes.Buffer
+	_, err := ExportTenant(&buf, source, config, "acme")
+	require.NoError(t, err)
+
+	_, err = ImportTenant(&buf, source, config, "")
+	assert.ErrorIs(t, err, ErrInvalidExport)
+}
+
+func TestImportDetectsAlteredExport(t *testing.T) {
+	source, config := createExportProvider(t, "acme")
+	saveCalculators(t, exportSession(t, source, config, "acme"))
+	var buf bytes.Buffer
+	_, err := ExportTenant(&buf, source, config, "acme")
+	require.NoError(t, err)
+
+	// {"Value":2} becomes {"Value":3}
+	altered := strings.Replace(buf.String(), `"Data":"eyJWYWx1ZSI6Mn0="`, `"Data":"eyJWYWx1ZSI6M30="`, 1)
+	require.NotEqual(t, buf.String(), altered)
+	target, _ := createExportProvider(t)
+	_, err = ImportTenant(strings.NewReader(altered), target, config, "")
+	assert.ErrorIs(t, err, ErrInvalidExport)
+	assert.ErrorContains(t, err, "does not match its hash")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	truncated := strings.Join(lines[:len(lines)-1], "\n")
+	target, _ = createExportProvider(t)
+	_, err = ImportTenant(strings.NewReader(truncated), target, config, "")
+	assert.ErrorIs(t, err, ErrInvalidExport)
+	assert.ErrorContains(t, err, "missing footer")
+
+	// Failed imports remove the tenant so the import can be retried
+	exists, err := target.TenantExists("acme")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	_, err = ImportTenant(&buf, target, config, "")
+	assert.NoError(t, err)
+}
+
+// snapshotDroppingProvider creates stores that silently discard saved snapshots.
+type snapshotDroppingProvider struct {
+	*MemoryStoreProvider
+}
+
+type snapshotDroppingStore struct {
+	*MemoryStore
+}
+
+func (p snapshotDroppingProvider) NewStore(tenant TenantId) (Store, error) {
+	store, err := p.MemoryStoreProvider.NewStore(tenant)
+	if err != nil {
+		return nil, err
+	}
+	return snapshotDroppingStore{store.(*MemoryStore)}, nil
+}
+
+func (s snapshotDroppingStore) SaveSnapshot(snapshot *Snapshot) error {
+	return nil
+}
+
+func TestImportVerifiesCountsAgainstTheTargetStore(t *testing.T) {
+	source, config := createExportProvider(t, "acme")
+	saveCalculators(t, exportSession(t, source, config, "acme"))
+	var buf bytes.Buffer
+	_, err := ExportTenant(&buf, source, config, "acme")
+	require.NoError(t, err)
+
+	target, _ := createExportProvider(t)
+	_, err = ImportTenant(&buf, snapshotDroppingProvider{target}, config, "")
+	assert.ErrorIs(t, err, ErrInvalidExport)
+	assert.ErrorContains(t, err, "tenant acme holds 6, 2 and 0")
+}
+
+func TestExportTenantsRejectsTenantIdsWithSlashes(t *testing.T) {
+	source, config := createExportProvider(t, "acme/eu")
+	_, err := ExportTenants(&bytes.Buffer{}, source, config, "acme/eu")
+	assert.ErrorIs(t, err, ErrInvalidExport)
+
+	var buf bytes.Buffer
+	_, err = ExportTenant(&buf, source, config, "acme/eu")
+	require.NoError(t, err)
+	var archive bytes.Buffer
+	writer := tar.NewWriter(&archive)
+	require.NoError(t, writer.WriteHeader(&tar.Header{Name: "acme/eu.jsonl", Mode: 0o644, Size: int64(buf.Len())}))
+	_, err = buf.WriteTo(writer)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	target, _ := createExportProvider(t)
+	_, err = ImportTenants(&archive, target, config)
+	assert.ErrorIs(t, err, ErrInvalidExport)
+	tenants, err := target.Tenants()
+	require.NoError(t, err)
+	assert.Empty(t, tenants)
+}
+
+func TestExportAndImportTenantArchive(t *testing.T) {
+	source, config := createExportProvider(t, "acme", "globex")
+	saveCalculators(t, exportSession(t, source, config, "acme"))
+	calc := newCalculator("g1")
+	calc.add(5)
+	require.NoError(t, exportSession(t, source, config, "globex").Save(calc))
+
+	var buf bytes.Buffer
+	exported, err := ExportTenants(&buf, source, config, "acme", "globex")
+	require.NoError(t, err)
+
+	target, _ := createExportProvider(t)
+	imported, err := ImportTenants(&buf, target, config)
+	require.NoError(t, err)
+	assert.Equal(t, exported, imported)
+	tenants, err := target.Tenants()
+	require.NoError(t, err)
+	assert.Equal(t, []TenantId{"acme", "globex"}, tenants)
+}
+
+func TestImportTenantsRemovesTenantsWhenAnImportFails(t *testing.T) {
+	source, config := createExportProvider(t, "acme", "globex")
+	saveCalculators(t, exportSession(t, source, config, "acme"))
+	var buf bytes.Buffer
+	_, err := ExportTenants(&buf, source, config, "acme", "globex")
+	require.NoError(t, err)
+
+	target, _ := createExportProvider(t, "globex")
+	_, err = ImportTenants(&buf, target, config)
+	assert.ErrorIs(t, err, ErrInvalidExport)
+	tenants, err := target.Tenants()
+	require.NoError(t, err)
+	assert.Equal(t, []TenantId{"globex"}, tenants)
+}
+
+func TestExportAndImportTenantThroughInstrumentedProviders(t *testing.T) {
+	memory, config := createExportProvider(t, "acme")
+	source := NewInstrumentedStoreProvider(memory, InstrumentationOptions{})
+	saveCalculators(t, exportSession(t, source, config, "acme"))
+	var buf bytes.Buffer
+	exported, err := ExportTenant(&buf, source, config, "acme")
+	require.NoError(t, err)
+
+	target, _ := createExportProvider(t)
+	imported, err := ImportTenant(&buf, NewInstrumentedStoreProvider(target, InstrumentationOptions{}), config, "")
+	require.NoError(t, err)
+	assert.Equal(t, exported, imported)
+	want, err := memory.ReadFeed("acme", 0, 0)
+	require.NoError(t, err)
+	got, err := target.ReadFeed("acme", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
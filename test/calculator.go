@@ -1,8 +1,6 @@
 package test
 
 import (
-	"fmt"
-
 	m "github.com/danyo1399/moments"
 )
 
@@ -31,21 +29,20 @@ var initStateFunc = func() CalculatorState {
 }
 var newCalculatorAggregate = m.NewAggregateFactory(CalculatorType, initStateFunc, reducer)
 
-func reducer(state CalculatorState, events ...any) CalculatorState {
-	for _, event := range events {
-		switch e := event.(type) {
-		case Calculator_Added_V1:
-			state.Value += e.Value
-		case Calculator_Subtracted_V1:
-			state.Value -= e.Value
-		case Calculator_Updated_V1:
-			state.Value = e.Value
-		default:
-			panic(fmt.Sprintln("unknown event type", e, event))
-		}
-	}
-	return state
-}
+var reducer = m.NewEventHandlers(
+	m.On(func(state CalculatorState, e Calculator_Added_V1) CalculatorState {
+		state.Value += e.Value
+		return state
+	}),
+	m.On(func(state CalculatorState, e Calculator_Subtracted_V1) CalculatorState {
+		state.Value -= e.Value
+		return state
+	}),
+	m.On(func(state CalculatorState, e Calculator_Updated_V1) CalculatorState {
+		state.Value = e.Value
+		return state
+	}),
+).Reducer()
 
 func (c *Calculator) subtract(val int) {
 	evt := Calculator_Subtracted_V1{val}
@@ -0,0 +1,116 @@
+package test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	m "github.com/danyo1399/moments"
+	"github.com/stretchr/testify/assert"
+)
+
+// EventGenerator returns a random event for the aggregate under test.
+type EventGenerator func(r *rand.Rand) any
+
+// ReducerCheck describes an aggregate whose reducer is checked by CheckReducer.
+type ReducerCheck[T any] struct {
+	// NewAggregate creates aggregates, typically the factory returned by RegisterAggregate.
+	NewAggregate func(options ...m.NewOption[T]) *m.Aggregate[T]
+	// Events generate the random events sequences are built from.
+	Events []EventGenerator
+	// Runs is the number of random sequences to check. Defaults to 100.
+	Runs int
+	// MaxEvents is the maximum length of each sequence. Defaults to 20.
+	MaxEvents int
+	// Seed makes the generated sequences reproducible. Defaults to a random seed,
+	// which is reported on failure.
+	Seed uint64
+	// Serialiser is the snapshot serialiser the aggregate is configured with.
+	// Defaults to JsonSnapshotSerialiser.
+	Serialiser *m.SnapshotSerialiser
+}
+
+// CheckReducer generates random event sequences and checks that the reducer is pure:
+// replaying events with Load gives the same state as applying them one at a time,
+// replaying is repeatable, restoring a snapshot and replaying the remaining events
+// gives the same state as a full replay, and the state survives the snapshot serialiser.
+func CheckReducer[T any](t testing.TB, check ReducerCheck[T]) {
+	t.Helper()
+	if len(check.Events) == 0 {
+		t.Fatal("CheckReducer requires at least one event generator")
+	}
+	runs := defaultIfZero(check.Runs, 100)
+	maxEvents := defaultIfZero(check.MaxEvents, 20)
+	seed := defaultIfZero(check.Seed, rand.Uint64())
+	serialiser := check.Serialiser
+	if serialiser == nil {
+		serialiser = &m.JsonSnapshotSerialiser
+	}
+	r := rand.New(rand.NewPCG(seed, seed))
+
+	for run := 0; run < runs; run++ {
+		events := make([]any, 1+r.IntN(maxEvents))
+		for i := range events {
+			events[i] = check.Events[r.IntN(len(check.Events))](r)
+		}
+		split := r.IntN(len(events) + 1)
+		details := fmt.Sprintf("seed %v run %v events %+v", seed, run, events)
+		if !checkSequence(t, check.NewAggregate, serialiser, events, split, details) {
+			return
+		}
+	}
+}
+
+func checkSequence[T any](
+	t testing.TB, newAggregate func(options ...m.NewOption[T]) *m.Aggregate[T],
+	serialiser *m.SnapshotSerialiser, events []any, split int, details string,
+) bool {
+	t.Helper()
+	const id = "reducer-check"
+
+	applied := newAggregate(m.WithId[T](id))
+	for _, evt := range events {
+		applied.Apply(evt, nil)
+	}
+	replayed := newAggregate(m.WithEvents[T](id, events))
+	if !assert.Equal(t, applied.State(), replayed.State(),
+		"replaying events with Load differs from applying them, %v", details) {
+		return false
+	}
+	if !assert.Equal(t, applied.Version(), replayed.Version(), "version mismatch, %v", details) {
+		return false
+	}
+
+	again := newAggregate(m.WithEvents[T](id, events))
+	if !assert.Equal(t, replayed.State(), again.State(), "replay is not deterministic, %v", details) {
+		return false
+	}
+
+	partial := newAggregate(m.WithEvents[T](id, events[:split]))
+	snapshot := partial.CreateSnapshot(*serialiser)
+	restored := newAggregate(m.WithSnapshot[T](&snapshot, serialiser))
+	restored.Load(events[split:])
+	if !assert.Equal(t, replayed.State(), restored.State(),
+		"snapshot after %v events then replay differs from full replay, %v", split, details) {
+		return false
+	}
+
+	state, err := serialiser.Marshal(replayed.State())
+	if !assert.NoError(t, err, "failed to serialise state, %v", details) {
+		return false
+	}
+	var roundTripped T
+	if !assert.NoError(t, serialiser.Unmarshal(state, &roundTripped), "failed to deserialise state, %v", details) {
+		return false
+	}
+	return assert.Equal(t, replayed.State(), roundTripped,
+		"state does not survive the snapshot serialiser round trip, %v", details)
+}
+
+func defaultIfZero[V comparable](value V, defaultValue V) V {
+	var zero V
+	if value == zero {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	m "github.com/danyo1399/moments"
+	"github.com/stretchr/testify/assert"
+)
+
+var calculatorEvents = []EventGenerator{
+	func(r *rand.Rand) any { return Calculator_Added_V1{r.IntN(100)} },
+	func(r *rand.Rand) any { return Calculator_Subtracted_V1{r.IntN(100)} },
+	func(r *rand.Rand) any { return Calculator_Updated_V1{r.IntN(100)} },
+}
+
+func TestCheckReducer(t *testing.T) {
+	CheckReducer(t, ReducerCheck[CalculatorState]{
+		NewAggregate: newCalculatorAggregate,
+		Events:       calculatorEvents,
+		Seed:         1,
+	})
+}
+
+// recordingTB captures assertion failures so a failing check can itself be tested.
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingTB) Helper() {}
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+type impureState struct {
+	Value int
+	// applied is not serialised so it is lost in snapshots
+	applied int
+}
+
+func TestCheckReducerDetectsImpureReducer(t *testing.T) {
+	calls := 0
+	newImpure := m.NewAggregateFactory("Impure", func() impureState { return impureState{} },
+		func(state impureState, events ...any) impureState {
+			for range events {
+				calls++
+				state.Value += calls
+				state.applied++
+			}
+			return state
+		})
+
+	tb := &recordingTB{TB: t}
+	CheckReducer(tb, ReducerCheck[impureState]{
+		NewAggregate: newImpure,
+		Events:       calculatorEvents,
+		Runs:         5,
+		Seed:         1,
+	})
+	assert.Len(t, tb.errors, 1)
+	assert.Contains(t, tb.errors[0], "replaying events with Load differs from applying them, seed 1 run 0")
+}
+
+func TestCheckReducerDetectsLostSnapshotState(t *testing.T) {
+	newLossy := m.NewAggregateFactory("Lossy", func() impureState { return impureState{} },
+		func(state impureState, events ...any) impureState {
+			for range events {
+				state.applied++
+			}
+			return state
+		})
+
+	tb := &recordingTB{TB: t}
+	CheckReducer(tb, ReducerCheck[impureState]{
+		NewAggregate: newLossy,
+		Events:       calculatorEvents,
+		Seed:         1,
+	})
+	assert.Len(t, tb.errors, 1)
+	assert.Contains(t, tb.errors[0], "then replay differs from full replay")
+}
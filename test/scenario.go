@@ -0,0 +1,125 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	m "github.com/danyo1399/moments"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAggregate is an aggregate that can be driven by a Scenario.
+type TestAggregate[T any] interface {
+	m.IAggregate
+	State() T
+}
+
+// Scenario is a given/when/then test of an aggregate.
+//
+//	Given[CalculatorState](t, NewCalculatorFromEvents, Calculator_Added_V1{1}).
+//		When(func(c *Calculator) error { c.add(2); return nil }).
+//		Then(Calculator_Added_V1{2})
+type Scenario[T any, A TestAggregate[T]] struct {
+	t         testing.TB
+	aggregate A
+	err       error
+	whenRun   bool
+}
+
+// Given creates a scenario whose aggregate is built from the given history by load.
+func Given[T any, A TestAggregate[T]](
+	t testing.TB, load func(id string, events []any) A, events ...any,
+) *Scenario[T, A] {
+	return &Scenario[T, A]{t: t, aggregate: load("", events)}
+}
+
+// When runs the action against the aggregate, recording any error or panic it produces.
+func (s *Scenario[T, A]) When(action func(aggregate A) error) *Scenario[T, A] {
+	s.t.Helper()
+	if s.whenRun {
+		s.t.Fatal("When can only be called once per scenario")
+	}
+	s.whenRun = true
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				if err, ok := r.(error); ok {
+					s.err = fmt.Errorf("panic: %w", err)
+				} else {
+					s.err = fmt.Errorf("panic: %v", r)
+				}
+			}
+		}()
+		s.err = action(s.aggregate)
+	}()
+	return s
+}
+
+// Then asserts that the action succeeded and emitted exactly the expected events in order.
+func (s *Scenario[T, A]) Then(expected ...any) *Scenario[T, A] {
+	s.t.Helper()
+	if s.err != nil {
+		s.t.Errorf("expected events but got error: %v", s.err)
+		return s
+	}
+	actual := make([]any, 0, len(s.aggregate.UnsavedEvents()))
+	for _, evt := range s.aggregate.UnsavedEvents() {
+		actual = append(actual, evt.Data)
+	}
+	if !reflect.DeepEqual(expected, actual) && !(len(expected) == 0 && len(actual) == 0) {
+		s.t.Errorf("unexpected events:\n%v", formatEventDiff(expected, actual))
+	}
+	return s
+}
+
+// ThenError asserts that the action failed with an error matching expected using errors.Is.
+func (s *Scenario[T, A]) ThenError(expected error) *Scenario[T, A] {
+	s.t.Helper()
+	if s.err == nil {
+		s.t.Errorf("expected error %q but the action succeeded", expected)
+		return s
+	}
+	if !errors.Is(s.err, expected) {
+		s.t.Errorf("expected error %q but got %q", expected, s.err)
+	}
+	return s
+}
+
+// ThenState asserts the aggregate state after the action.
+func (s *Scenario[T, A]) ThenState(expected T) *Scenario[T, A] {
+	s.t.Helper()
+	assert.Equal(s.t, expected, s.aggregate.State(), "unexpected aggregate state")
+	return s
+}
+
+// Aggregate returns the aggregate under test for further assertions.
+func (s *Scenario[T, A]) Aggregate() A {
+	return s.aggregate
+}
+
+// formatEventDiff lists expected and actual events side by side,
+// marking matches with = and differences with -/+.
+func formatEventDiff(expected []any, actual []any) string {
+	var b strings.Builder
+	for i := 0; i < max(len(expected), len(actual)); i++ {
+		switch {
+		case i >= len(actual):
+			fmt.Fprintf(&b, "  #%d - %v\n", i, formatEvent(expected[i]))
+		case i >= len(expected):
+			fmt.Fprintf(&b, "  #%d + %v\n", i, formatEvent(actual[i]))
+		case reflect.DeepEqual(expected[i], actual[i]):
+			fmt.Fprintf(&b, "  #%d = %v\n", i, formatEvent(actual[i]))
+		default:
+			fmt.Fprintf(&b, "  #%d - %v\n", i, formatEvent(expected[i]))
+			fmt.Fprintf(&b, "     + %v\n", formatEvent(actual[i]))
+		}
+	}
+	return b.String()
+}
+
+func formatEvent(evt any) string {
+	return fmt.Sprintf("%T%+v", evt, evt)
+}
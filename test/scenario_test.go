@@ -0,0 +1,62 @@
+package test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errTooLarge = errors.New("value too large")
+
+func TestScenarioThen(t *testing.T) {
+	Given[CalculatorState](t, NewCalculatorFromEvents, Calculator_Updated_V1{5}).
+		When(func(c *Calculator) error {
+			c.add(2)
+			c.subtract(1)
+			return nil
+		}).
+		Then(Calculator_Added_V1{2}, Calculator_Subtracted_V1{1}).
+		ThenState(CalculatorState{6})
+}
+
+func TestScenarioNoEvents(t *testing.T) {
+	Given[CalculatorState](t, NewCalculatorFromEvents).
+		When(func(c *Calculator) error { return nil }).
+		Then().
+		ThenState(CalculatorState{0})
+}
+
+func TestScenarioThenError(t *testing.T) {
+	Given[CalculatorState](t, NewCalculatorFromEvents, Calculator_Updated_V1{5}).
+		When(func(c *Calculator) error {
+			if c.State().Value > 1 {
+				return errTooLarge
+			}
+			c.add(1)
+			return nil
+		}).
+		ThenError(errTooLarge).
+		ThenState(CalculatorState{5})
+}
+
+func TestScenarioThenErrorMatchesPanics(t *testing.T) {
+	Given[CalculatorState](t, NewCalculatorFromEvents, Calculator_Updated_V1{5}).
+		When(func(c *Calculator) error {
+			panic(errTooLarge)
+		}).
+		ThenError(errTooLarge).
+		ThenState(CalculatorState{5})
+}
+
+func TestFormatEventDiff(t *testing.T) {
+	diff := formatEventDiff(
+		[]any{Calculator_Added_V1{1}, Calculator_Added_V1{2}},
+		[]any{Calculator_Added_V1{1}, Calculator_Added_V1{3}, Calculator_Subtracted_V1{1}},
+	)
+	assert.Equal(t, ""+
+		"  #0 = test.Calculator_Added_V1{Value:1}\n"+
+		"  #1 - test.Calculator_Added_V1{Value:2}\n"+
+		"     + test.Calculator_Added_V1{Value:3}\n"+
+		"  #2 + test.Calculator_Subtracted_V1{Value:1}\n", diff)
+}
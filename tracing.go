@@ -0,0 +1,73 @@
+package moments
+
+import "context"
+
+// Attribute is a key value pair attached to a span.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+func Attr(key string, value any) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Span is a unit of traced work. Implementations typically wrap an OpenTelemetry span.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+	// TraceId returns the id of the trace the span belongs to, or empty when not recording.
+	TraceId() string
+}
+
+// Tracer starts spans around session and store operations.
+type Tracer interface {
+	// Start begins a span as a child of any span in ctx and returns a context holding the new span.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+const (
+	AttrTenant        = "moments.tenant"
+	AttrAggregateType = "moments.aggregate_type"
+	AttrStreamId      = "moments.stream_id"
+	AttrVersion       = "moments.version"
+	AttrEventCount    = "moments.event_count"
+	AttrCorrelationId = "moments.correlation_id"
+)
+
+type noopTracer struct{}
+type noopSpan struct{}
+
+func (noopTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (noopSpan) SetAttributes(attrs ...Attribute) {}
+func (noopSpan) RecordError(err error)            {}
+func (noopSpan) End()                             {}
+func (noopSpan) TraceId() string                  { return "" }
+
+// NoopTracer is the default Tracer and records nothing.
+var NoopTracer Tracer = noopTracer{}
+
+type correlationIdKey struct{}
+
+// startSpan starts a span with the configured tracer.
+func (c *Config) startSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if c.Tracer == nil {
+		return NoopTracer.Start(ctx, name, attrs...)
+	}
+	return c.Tracer.Start(ctx, name, attrs...)
+}
+
+// endSpan records err on the span, if any, and ends it.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
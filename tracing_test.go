@@ -0,0 +1,136 @@
+package moments
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordedSpan struct {
+	name   string
+	parent string
+	attrs  map[string]any
+	err    error
+	ended  bool
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...Attribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+func (s *recordedSpan) RecordError(err error) { s.err = err }
+func (s *recordedSpan) End()                  { s.ended = true }
+func (s *recordedSpan) TraceId() string       { return "trace-1" }
+
+type spanKey struct{}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &recordedSpan{name: name, attrs: map[string]any{}}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		span.parent = parent.name
+	}
+	span.SetAttributes(attrs...)
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func (t *recordingTracer) names() []string {
+	return mapSlice(t.spans, func(s *recordedSpan) string { return s.name })
+}
+
+func (t *recordingTracer) span(name string) *recordedSpan {
+	for _, s := range t.spans {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func createTracedSession(t *testing.T, tracer Tracer) *Session {
+	return createSession(t, Config{
+		Aggregates: map[AggregateType]AggregateConfig{
+			calculatorType: {StoreStrategy: alwaysSnapshot},
+		},
+		EventDeserialiser: createEventDeserialiser(),
+		Tracer:            tracer,
+	})
+}
+
+func TestTracingSave(t *testing.T) {
+	tracer := &recordingTracer{}
+	session := createTracedSession(t, tracer)
+	defer session.Close()
+
+	calc := newCalculator("c1")
+	calc.update(5)
+	calc.add(2)
+	assert.NoError(t, session.Save(calc))
+
+	assert.Equal(t, []string{"moments.session.save", "moments.snapshot.save", "moments.store.save_events"}, tracer.names())
+	save := tracer.span("moments.session.save")
+	assert.Equal(t, "Calculator", save.attrs[AttrAggregateType])
+	assert.Equal(t, "Calculator:c1", save.attrs[AttrStreamId])
+	assert.Equal(t, 2, save.attrs[AttrEventCount])
+	assert.Equal(t, "trace-1", save.attrs[AttrCorrelationId])
+	assert.Equal(t, "moments.session.save", tracer.span("moments.store.save_events").parent)
+	for _, span := range tracer.spans {
+		assert.True(t, span.ended, span.name)
+	}
+
+	events, err := session.LoadStream(calc.StreamId())
+	assert.NoError(t, err)
+	assert.Equal(t, CorrelationId("trace-1"), events[0].CorrelationId)
+}
+
+func TestTracingLoadAggregate(t *testing.T) {
+	tracer := &recordingTracer{}
+	session := createTracedSession(t, tracer)
+	defer session.Close()
+
+	calc := newCalculator("c1")
+	calc.update(5)
+	assert.NoError(t, session.Save(calc))
+	tracer.spans = nil
+
+	assert.NoError(t, session.LoadAggregate(newCalculator("c1")))
+	assert.Equal(t, []string{
+		"moments.session.load_aggregate", "moments.snapshot.load",
+		"moments.store.load_snapshot", "moments.store.load_events",
+	}, tracer.names())
+	assert.Equal(t, Version(1), tracer.span("moments.session.load_aggregate").attrs[AttrVersion])
+	assert.Equal(t, "moments.snapshot.load", tracer.span("moments.store.load_snapshot").parent)
+	assert.Equal(t, "moments.session.load_aggregate", tracer.span("moments.store.load_events").parent)
+	assert.Equal(t, 0, tracer.span("moments.store.load_events").attrs[AttrEventCount])
+}
+
+func TestTracingRecordsErrors(t *testing.T) {
+	tracer := &recordingTracer{}
+	session := createTracedSession(t, tracer)
+	defer session.Close()
+	session.CorrelationId = "corr"
+
+	calc := newCalculator("c1")
+	calc.add(1)
+	assert.NoError(t, session.Save(calc))
+	stale := newCalculator("c1")
+	stale.add(1)
+	err := session.Save(stale)
+	assert.Error(t, err)
+
+	save := tracer.spans[len(tracer.spans)-3]
+	assert.Equal(t, "moments.session.save", save.name)
+	assert.Equal(t, "corr", save.attrs[AttrCorrelationId])
+	assert.True(t, errors.Is(save.err, ErrConcurrencyConflict))
+}